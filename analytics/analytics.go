@@ -0,0 +1,247 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+// Package analytics splits the income of instances by source. Instances append
+// a record for every parsed result to their income history, which can be
+// summarized per instance and per cluster.
+package analytics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HistoryName is the name of the income history of an instance. It is saved as
+// HistoryName + ".jsonl" in the data directory of the instance.
+const HistoryName = "income"
+
+const (
+	SourceBeg       = "beg"
+	SourceFish      = "fish"
+	SourceHunt      = "hunt"
+	SourceSearch    = "search"
+	SourcePostmeme  = "postmeme"
+	SourceHighlow   = "highlow"
+	SourceBlackjack = "blackjack"
+	SourceSell      = "sell"
+)
+
+// Sources holds all sources in the order in which they are reported.
+var Sources = []string{
+	SourceBeg,
+	SourceFish,
+	SourceHunt,
+	SourceSearch,
+	SourcePostmeme,
+	SourceHighlow,
+	SourceBlackjack,
+	SourceSell,
+}
+
+// Record is a single result of a command. Coins is the amount of coins gained,
+// or lost if negative. Items is the estimated sell value of the items gained,
+// so selling items adds coins and subtracts their value.
+type Record struct {
+	Time     time.Time `json:"time"`
+	Instance string    `json:"instance"`
+	Username string    `json:"username"`
+	Cluster  string    `json:"cluster"`
+	Source   string    `json:"source"`
+	Coins    int       `json:"coins"`
+	Items    int       `json:"items"`
+}
+
+// Total is the income of a single source.
+type Total struct {
+	Coins int
+	Items int
+	Count int
+}
+
+// Net returns the coins and the value of the items together.
+func (t Total) Net() int {
+	return t.Coins + t.Items
+}
+
+// Summary is the income of an instance or cluster between the first and the
+// last record.
+type Summary struct {
+	// Name is the username of the instance or the name of the cluster.
+	Name    string
+	Cluster string
+	Start   time.Time
+	End     time.Time
+	Sources map[string]Total
+}
+
+func newSummary(name, cluster string) *Summary {
+	return &Summary{Name: name, Cluster: cluster, Sources: map[string]Total{}}
+}
+
+func (s *Summary) add(r Record) {
+	if s.Start.IsZero() || r.Time.Before(s.Start) {
+		s.Start = r.Time
+	}
+	if r.Time.After(s.End) {
+		s.End = r.Time
+	}
+	t := s.Sources[r.Source]
+	t.Coins += r.Coins
+	t.Items += r.Items
+	t.Count++
+	s.Sources[r.Source] = t
+}
+
+// Total returns the income of all sources together.
+func (s Summary) Total() Total {
+	var total Total
+	for _, t := range s.Sources {
+		total.Coins += t.Coins
+		total.Items += t.Items
+		total.Count += t.Count
+	}
+	return total
+}
+
+// Hourly returns the average net income per hour of n over the duration of the
+// summary. If the summary spans less than an hour, n itself is returned.
+func (s Summary) Hourly(n int) float64 {
+	hours := s.End.Sub(s.Start).Hours()
+	if hours < 1 {
+		return float64(n)
+	}
+	return float64(n) / hours
+}
+
+// Daily returns the average net income per day of n over the duration of the
+// summary. If the summary spans less than a day, n itself is returned.
+func (s Summary) Daily(n int) float64 {
+	days := s.End.Sub(s.Start).Hours() / 24
+	if days < 1 {
+		return float64(n)
+	}
+	return float64(n) / days
+}
+
+// ByInstance summarizes records per instance, sorted by cluster and username.
+func ByInstance(records []Record) []Summary {
+	return summarize(records, func(r Record) (string, string, string) {
+		return r.Instance, r.Username, r.Cluster
+	})
+}
+
+// ByCluster summarizes records per cluster, sorted by name.
+func ByCluster(records []Record) []Summary {
+	return summarize(records, func(r Record) (string, string, string) {
+		return r.Cluster, r.Cluster, r.Cluster
+	})
+}
+
+func summarize(records []Record, group func(r Record) (key, name, cluster string)) []Summary {
+	m := map[string]*Summary{}
+	for _, r := range records {
+		key, name, cluster := group(r)
+		if m[key] == nil {
+			m[key] = newSummary(name, cluster)
+		}
+		m[key].add(r)
+	}
+	var summaries []Summary
+	for _, s := range m {
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Cluster != summaries[j].Cluster {
+			return summaries[i].Cluster < summaries[j].Cluster
+		}
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries
+}
+
+// ReadDir reads the income history of every instance in dataDir. Records before
+// since are left out.
+func ReadDir(dataDir string, since time.Time) ([]Record, error) {
+	paths, err := filepath.Glob(filepath.Join(dataDir, "*", HistoryName+".jsonl"))
+	if err != nil {
+		return nil, fmt.Errorf("error while finding income history: %v", err)
+	}
+	var records []Record
+	for _, p := range paths {
+		rs, err := readFile(p, since)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rs...)
+	}
+	return records, nil
+}
+
+func readFile(path string, since time.Time) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening income history: %v", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		var r Record
+		if err = json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("error while decoding %v line %v: %v", path, line, err)
+		}
+		if r.Time.Before(since) {
+			continue
+		}
+		records = append(records, r)
+	}
+	if err = sc.Err(); err != nil {
+		return nil, fmt.Errorf("error while reading income history: %v", err)
+	}
+	return records, nil
+}
+
+// Tracker keeps the income of a running instance in memory. It is safe for
+// concurrent use.
+type Tracker struct {
+	mu      sync.Mutex
+	summary *Summary
+}
+
+// Add adds r to the tracked income.
+func (t *Tracker) Add(r Record) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.summary == nil {
+		t.summary = newSummary(r.Username, r.Cluster)
+		t.summary.Start = time.Now()
+	}
+	t.summary.add(r)
+	t.summary.End = time.Now()
+}
+
+// Summary returns the income tracked so far.
+func (t *Tracker) Summary() Summary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.summary == nil {
+		return Summary{Sources: map[string]Total{}}
+	}
+	s := *t.summary
+	s.End = time.Now()
+	s.Sources = map[string]Total{}
+	for k, v := range t.summary.Sources {
+		s.Sources[k] = v
+	}
+	return s
+}
@@ -18,12 +18,147 @@ const (
 	ShiftStateDormant = "dormant"
 )
 
+const (
+	BetStrategyFlat       = "flat"
+	BetStrategyPercentage = "percentage"
+	BetStrategyKelly      = "kelly"
+)
+
+// Targets of routes besides instance names.
+const (
+	TargetMaster  = "master"
+	TargetPoorest = "poorest"
+	TargetRichest = "richest"
+)
+
+const (
+	StrategyWhitelist     = "whitelist"
+	StrategyUniform       = "uniform"
+	StrategyWeighted      = "weighted"
+	StrategyBestEV        = "best_ev"
+	StrategyEpsilonGreedy = "epsilon_greedy"
+)
+
 type Config struct {
 	Clusters           map[string]Cluster `yaml:"clusters"`
 	Shifts             []Shift            `yaml:"shifts"`
 	Features           Features           `yaml:"features"`
 	Compat             Compat             `yaml:"compatibility"`
 	SuspicionAvoidance SuspicionAvoidance `yaml:"suspicion_avoidance"`
+	Coordinator        Coordinator        `yaml:"coordinator"`
+	Journal            Journal            `yaml:"journal"`
+	Metrics            Metrics            `yaml:"metrics"`
+	Control            Control            `yaml:"control"`
+	Notifications      Notifications      `yaml:"notifications"`
+	Logging            Logging            `yaml:"logging"`
+}
+
+// Logging configures the format of the logs written to the standard output and
+// the log level of every component of an instance.
+type Logging struct {
+	Format string `yaml:"format"`
+
+	// Levels maps the LogComponent constants to a logrus level, such as
+	// "debug" or "warning".
+	Levels map[string]string `yaml:"levels"`
+
+	// Directory is the directory log files are written to. A relative path is
+	// relative to the directory of the executable. If it is an empty string,
+	// the logs directory next to the executable is used.
+	Directory string      `yaml:"directory"`
+	Rotation  LogRotation `yaml:"rotation"`
+}
+
+// LogRotation configures when log files are rotated and how long rotated files
+// are kept.
+type LogRotation struct {
+	MaximumSize  int  `yaml:"maximum_size"` // In megabytes.
+	Interval     int  `yaml:"interval"`     // In hours.
+	Compress     bool `yaml:"compress"`
+	MaximumAge   int  `yaml:"maximum_age"` // In days.
+	MaximumFiles int  `yaml:"maximum_files"`
+}
+
+// DefaultLogRotation is used if the log rotation options are left out of the
+// config. A new file is started every day and rotated files are kept.
+var DefaultLogRotation = LogRotation{Interval: 24}
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+const (
+	LogComponentInstance  = "instance"
+	LogComponentScheduler = "scheduler"
+	LogComponentRouter    = "router"
+	LogComponentWS        = "ws"
+)
+
+// LogComponents are all components that can have their own log level.
+var LogComponents = []string{
+	LogComponentInstance,
+	LogComponentScheduler,
+	LogComponentRouter,
+	LogComponentWS,
+}
+
+// Notifications configures where notifications about important events of
+// instances are sent.
+type Notifications struct {
+	Enable bool               `yaml:"enable"`
+	Sinks  []NotificationSink `yaml:"sinks"`
+
+	// RareItems are the names of the items which are considered rare. Items
+	// worth at least RareItemValue are considered rare too.
+	RareItems     []string `yaml:"rare_items"`
+	RareItemValue int      `yaml:"rare_item_value"`
+}
+
+// NotificationSink is a destination of notifications, see the SinkType
+// constants.
+type NotificationSink struct {
+	Type     string   `yaml:"type"`
+	URL      string   `yaml:"url"`
+	Command  string   `yaml:"command"`
+	Events   []string `yaml:"events"`
+	Cooldown int      `yaml:"cooldown"`
+}
+
+const (
+	SinkTypeWebhook = "webhook"
+	SinkTypeHTTP    = "http"
+	SinkTypeCommand = "command"
+)
+
+// Control configures the local HTTP API and status page used to inspect and
+// control running instances.
+type Control struct {
+	Enable  bool   `yaml:"enable"`
+	Address string `yaml:"address"`
+	Token   string `yaml:"token"` // The bearer token required for all API requests, empty for none.
+}
+
+// Metrics configures the HTTP endpoint which serves metrics of all instances
+// in the Prometheus text format.
+type Metrics struct {
+	Enable  bool   `yaml:"enable"`
+	Address string `yaml:"address"`
+}
+
+// Journal configures the journal of commands sent and messages received. The
+// maximum size is in megabytes, a maximum size of 0 disables rotation. A
+// maximum of 0 files keeps all rotated files.
+type Journal struct {
+	Enable       bool `yaml:"enable"`
+	MaximumSize  int  `yaml:"maximum_size"`
+	MaximumFiles int  `yaml:"maximum_files"`
+}
+
+// Coordinator configures coordination between clusters. If enabled, share and
+// gift routes may target instances of other clusters.
+type Coordinator struct {
+	Enable bool `yaml:"enable"`
 }
 
 type Cluster struct {
@@ -32,6 +167,7 @@ type Cluster struct {
 }
 
 type Instance struct {
+	Name               string             `yaml:"name"` // Used to refer to the instance in routes.
 	Token              string             `yaml:"token"`
 	ChannelID          string             `yaml:"channel_id"`
 	Features           Features           `yaml:"-"`
@@ -55,11 +191,59 @@ type override struct {
 }
 
 type Compat struct {
-	PostmemeOpts         []string `yaml:"postmeme"`
-	AllowedSearches      []string `yaml:"allowed_searches"`
-	SearchCancel         []string `yaml:"search_cancel"`
-	Cooldown             Cooldown `yaml:"cooldown"`
-	AwaitResponseTimeout int      `yaml:"await_response_timeout"`
+	PostmemeOpts         []string         `yaml:"postmeme"`
+	PostmemeStrategy     PostmemeStrategy `yaml:"postmeme_strategy"`
+	AllowedSearches      []string         `yaml:"allowed_searches"`
+	SearchCancel         []string         `yaml:"search_cancel"`
+	SearchStrategy       SearchStrategy   `yaml:"search_strategy"`
+	Highlow              Highlow          `yaml:"highlow"`
+	ItemPrices           map[string]int   `yaml:"item_prices"`
+	ShareTax             float64          `yaml:"share_tax"` // The percentage of coins lost when sharing.
+	Cooldown             Cooldown         `yaml:"cooldown"`
+	AwaitResponseTimeout int              `yaml:"await_response_timeout"`
+}
+
+// Highlow configures how the highlow command is answered. A hint above the
+// threshold is answered with "low", a hint below it with "high".
+type Highlow struct {
+	Minimum    int  `yaml:"minimum"` // The lowest possible hint.
+	Maximum    int  `yaml:"maximum"` // The highest possible hint.
+	Threshold  int  `yaml:"threshold"`
+	Jackpot    bool `yaml:"jackpot"`     // Whether to answer "jackpot" if the hint equals the threshold.
+	BucketSize int  `yaml:"bucket_size"` // The size of the hint ranges win rates are tracked for.
+}
+
+// DefaultHighlow is used if the highlow compatibility options are left out of
+// the config, which matches the behaviour from before they were configurable.
+var DefaultHighlow = Highlow{
+	Minimum:    1,
+	Maximum:    100,
+	Threshold:  50,
+	BucketSize: 10,
+}
+
+// DefaultShareTax is used if the share tax is left out of the config.
+const DefaultShareTax = 8
+
+// DefaultBlackjackMaximumBalance is used if the auto-blackjack maximum balance
+// is left out of the config.
+const DefaultBlackjackMaximumBalance = 10000000
+
+// PostmemeStrategy configures how a meme type is picked from the postmeme
+// options.
+type PostmemeStrategy struct {
+	Strategy       string             `yaml:"strategy"`
+	Epsilon        float64            `yaml:"epsilon"`         // The chance from [0,1] to explore a random option.
+	MinimumSamples int                `yaml:"minimum_samples"` // Samples required before a meme type's statistics are trusted.
+	Weights        map[string]float64 `yaml:"weights"`         // Options that are left out have a weight of 1.
+}
+
+// SearchStrategy configures how a location is picked from the options the
+// search command offers.
+type SearchStrategy struct {
+	Strategy       string  `yaml:"strategy"`
+	Epsilon        float64 `yaml:"epsilon"`         // The chance from [0,1] to explore a random option.
+	MinimumSamples int     `yaml:"minimum_samples"` // Samples required before a location's statistics are trusted.
 }
 
 type Cooldown struct {
@@ -84,42 +268,155 @@ type Features struct {
 	AutoBlackjack      AutoBlackjack   `yaml:"auto_blackjack"`
 	AutoShare          AutoShare       `yaml:"auto_share"`
 	AutoTidepod        AutoTidepod     `yaml:"auto_tidepod"`
+	AutoBank           AutoBank        `yaml:"auto_bank"`
+	AutoUse            AutoUse         `yaml:"auto_use"`
+	Rewards            Rewards         `yaml:"rewards"`
 	BalanceCheck       BalanceCheck    `yaml:"balance_check"`
+	InventoryCheck     InventoryCheck  `yaml:"inventory_check"`
+	RemoteControl      RemoteControl   `yaml:"remote_control"`
 	LogToFile          bool            `yaml:"log_to_file"`
 	VerboseLogToStdout bool            `yaml:"verbose_log_to_stdout"`
 	Debug              bool            `yaml:"debug"`
 }
 
+// RemoteControl lets owners control the instances of a cluster with commands
+// sent in Discord. Only the master of a cluster listens for commands, in
+// ChannelID and in direct messages.
+type RemoteControl struct {
+	Enable    bool     `yaml:"enable"`
+	ChannelID string   `yaml:"channel_id"`
+	Owners    []string `yaml:"owners"`
+	Prefix    string   `yaml:"prefix"`
+}
+
+// DefaultRemoteControlPrefix is the prefix of remote control commands if none
+// is configured.
+const DefaultRemoteControlPrefix = "!dg"
+
 type BalanceCheck struct {
 	Enable   bool `yaml:"enable"`
 	Interval int  `yaml:"interval"`
 }
 
+type InventoryCheck struct {
+	Enable   bool `yaml:"enable"`
+	Interval int  `yaml:"interval"`
+}
+
 type AutoTidepod struct {
 	Enable              bool `yaml:"enable"`
 	Interval            int  `yaml:"interval"`
 	BuyLifesaverOnDeath bool `yaml:"buy_lifesaver_on_death"`
 }
 
+type Rewards struct {
+	Enable  bool `yaml:"enable"`
+	Daily   bool `yaml:"daily"`
+	Weekly  bool `yaml:"weekly"`
+	Monthly bool `yaml:"monthly"`
+}
+
+type AutoUse struct {
+	Enable bool          `yaml:"enable"`
+	Items  []AutoUseItem `yaml:"items"`
+}
+
+type AutoUseItem struct {
+	Item     string `yaml:"item"`
+	Interval int    `yaml:"interval"` // Seconds between uses, 0 to use the item again when its effect expires.
+	Duration int    `yaml:"duration"` // Seconds for which the effect of the item is active.
+	Buy      bool   `yaml:"buy"`      // Whether to buy the item if it is not owned.
+}
+
 type AutoBlackjack struct {
 	Enable            bool                         `yaml:"enable"`
 	Priority          bool                         `yaml:"priority"`
 	Amount            int                          `yaml:"amount"`
 	PauseBelowBalance int                          `yaml:"pause_below_balance"`
+	MaximumBalance    int                          `yaml:"maximum_balance"`
+	Bet               BlackjackBet                 `yaml:"bet"`
+	StopLoss          int                          `yaml:"stop_loss"`
+	TakeProfit        int                          `yaml:"take_profit"`
+	Strategy          string                       `yaml:"strategy"`
 	LogicTable        map[string]map[string]string `yaml:"logic_table"`
 }
 
+// BlackjackBet configures how much is bet on every game of blackjack.
+type BlackjackBet struct {
+	Strategy      string  `yaml:"strategy"`
+	Percentage    float64 `yaml:"percentage"`     // The percentage of the wallet to bet.
+	KellyFraction float64 `yaml:"kelly_fraction"` // The fraction of the Kelly bet to bet.
+	Minimum       int     `yaml:"minimum"`
+	Maximum       int     `yaml:"maximum"`
+}
+
+type AutoBank struct {
+	Enable       bool `yaml:"enable"`
+	DepositAbove int  `yaml:"deposit_above"`
+	WalletFloat  int  `yaml:"wallet_float"`
+}
+
 type AutoShare struct {
-	Enable         bool `yaml:"enable"`
-	Fund           bool `yaml:"fund"`
-	MaximumBalance int  `yaml:"maximum_balance"`
-	MinimumBalance int  `yaml:"minimum_balance"`
+	Enable         bool         `yaml:"enable"`
+	Fund           bool         `yaml:"fund"`
+	MaximumBalance int          `yaml:"maximum_balance"`
+	MinimumBalance int          `yaml:"minimum_balance"`
+	Routes         []ShareRoute `yaml:"routes"`
+}
+
+// ShareRoute configures where coins are shared to. Coins are shared if the
+// wallet balance is above Above, and as many are shared as possible while
+// keeping Keep, up to Maximum.
+type ShareRoute struct {
+	Cluster string `yaml:"cluster"` // The cluster of the target, empty for the own cluster.
+	Target  string `yaml:"target"`  // TargetMaster, TargetPoorest, TargetRichest or the name of an instance.
+	Above   int    `yaml:"above"`
+	Keep    int    `yaml:"keep"`
+	Maximum int    `yaml:"maximum"` // 0 for no maximum.
 }
 
 type AutoGift struct {
-	Enable   bool     `yaml:"enable"`
-	Interval int      `yaml:"interval"`
-	Items    []string `yaml:"items"`
+	Enable   bool        `yaml:"enable"`
+	Interval int         `yaml:"interval"`
+	Items    []string    `yaml:"items"`
+	Routes   []GiftRoute `yaml:"routes"`
+}
+
+// GiftRoute configures where an item is gifted to. As many are gifted as
+// possible while keeping Keep, up to Maximum.
+type GiftRoute struct {
+	Item    string `yaml:"item"`
+	Cluster string `yaml:"cluster"` // The cluster of the target, empty for the own cluster.
+	Target  string `yaml:"target"`  // TargetMaster, TargetPoorest, TargetRichest or the name of an instance.
+	Keep    int    `yaml:"keep"`
+	Maximum int    `yaml:"maximum"` // 0 for no maximum.
+}
+
+// ShareRoutes returns the configured share routes followed by the route to the
+// master instance configured by the maximum and minimum balance. As in configs
+// from before routes existed, the route to the master is always used if no
+// routes are configured, even with a maximum balance of 0. Otherwise it is only
+// used if the maximum balance is greater than 0.
+func (f Features) ShareRoutes() []ShareRoute {
+	routes := append([]ShareRoute{}, f.AutoShare.Routes...)
+	if f.AutoShare.MaximumBalance > 0 || len(f.AutoShare.Routes) == 0 {
+		routes = append(routes, ShareRoute{
+			Target: TargetMaster,
+			Above:  f.AutoShare.MaximumBalance,
+			Keep:   f.AutoShare.MinimumBalance,
+		})
+	}
+	return routes
+}
+
+// GiftRoutes returns the configured gift routes followed by a route to the
+// master instance for every item in the items list.
+func (f Features) GiftRoutes() []GiftRoute {
+	routes := append([]GiftRoute{}, f.AutoGift.Routes...)
+	for _, item := range f.AutoGift.Items {
+		routes = append(routes, GiftRoute{Item: item, Target: TargetMaster})
+	}
+	return routes
 }
 
 type CustomCommand struct {
@@ -130,15 +427,96 @@ type CustomCommand struct {
 }
 
 type AutoBuy struct {
-	FishingPole  bool `yaml:"fishing_pole"`
-	HuntingRifle bool `yaml:"hunting_rifle"`
-	Laptop       bool `yaml:"laptop"`
+	FishingPole  bool          `yaml:"fishing_pole"`
+	HuntingRifle bool          `yaml:"hunting_rifle"`
+	Laptop       bool          `yaml:"laptop"`
+	Rules        []AutoBuyRule `yaml:"rules"`
+}
+
+// AutoBuyRule configures the purchase of an item when a message matching
+// Pattern is received in response to Command.
+type AutoBuyRule struct {
+	Pattern        string `yaml:"pattern"` // A regular expression matched against the message content.
+	Command        string `yaml:"command"` // The command that needs the item.
+	Item           string `yaml:"item"`
+	ShopName       string `yaml:"shop_name"` // The name of the item in the shop, used to look up its price.
+	Amount         int    `yaml:"amount"`
+	MaximumPrice   int    `yaml:"maximum_price"`   // The maximum price per item, 0 for no maximum.
+	MinimumBalance int    `yaml:"minimum_balance"` // The wallet balance to keep after buying.
+	Retry          bool   `yaml:"retry"`           // Whether to send Command again after buying.
+	Mentions       bool   `yaml:"mentions"`        // Whether the message has to mention the user.
+}
+
+// ShopKey returns the name under which the item of r is listed in the shop,
+// which is ShopName, or Item if ShopName is left out.
+func (r AutoBuyRule) ShopKey() string {
+	if r.ShopName != "" {
+		return r.ShopName
+	}
+	return r.Item
+}
+
+// The auto-buy rules enabled by the fishing_pole, hunting_rifle and laptop
+// options and by auto-tidepod.
+var (
+	FishingPoleRule = AutoBuyRule{
+		Pattern:  `You don't have a fishing pole`,
+		Command:  "pls fish",
+		Item:     "fishing",
+		ShopName: "Fishing Pole",
+		Amount:   1,
+		Mentions: true,
+	}
+	HuntingRifleRule = AutoBuyRule{
+		Pattern:  `You don't have a hunting rifle`,
+		Command:  "pls hunt",
+		Item:     "rifle",
+		ShopName: "Hunting Rifle",
+		Amount:   1,
+		Mentions: true,
+	}
+	LaptopRule = AutoBuyRule{
+		Pattern:  `oi you need to buy a laptop in the shop to post memes`,
+		Command:  "pls pm",
+		Item:     "laptop",
+		ShopName: "Laptop",
+		Amount:   1,
+		Mentions: true,
+	}
+	TidepodRule = AutoBuyRule{
+		Pattern:  `You don't own this item\?\?`,
+		Command:  "pls use tidepod",
+		Item:     "tide",
+		ShopName: "Tidepod",
+		Amount:   1,
+		Retry:    true,
+	}
+)
+
+// AutoBuyRules returns the configured auto-buy rules followed by the default
+// rules that are enabled.
+func (f Features) AutoBuyRules() []AutoBuyRule {
+	rules := append([]AutoBuyRule{}, f.AutoBuy.Rules...)
+	if f.AutoBuy.FishingPole {
+		rules = append(rules, FishingPoleRule)
+	}
+	if f.AutoBuy.HuntingRifle {
+		rules = append(rules, HuntingRifleRule)
+	}
+	if f.AutoBuy.Laptop {
+		rules = append(rules, LaptopRule)
+	}
+	if f.AutoTidepod.Enable {
+		rules = append(rules, TidepodRule)
+	}
+	return rules
 }
 
 type AutoSell struct {
-	Enable   bool     `yaml:"enable"`
-	Interval int      `yaml:"interval"`
-	Items    []string `yaml:"items"`
+	Enable       bool           `yaml:"enable"`
+	Interval     int            `yaml:"interval"`
+	Items        []string       `yaml:"items"`
+	MinimumStock map[string]int `yaml:"minimum_stock"`
 }
 
 type Commands struct {
@@ -187,11 +565,22 @@ func Load(path string) (Config, error) {
 	}
 	defer f.Close()
 
+	// Defaults which may be disabled with a zero value are set before
+	// decoding, so they only apply if the config leaves them out.
 	var cfg Config
+	cfg.Features.AutoBlackjack.MaximumBalance = DefaultBlackjackMaximumBalance
+	cfg.Compat.ShareTax = DefaultShareTax
 	if err = yaml.NewDecoder(f).Decode(&cfg); err != nil {
 		return Config{}, fmt.Errorf("error while decoding config: %v", err)
 	}
 
+	if cfg.Compat.Highlow == (Highlow{}) {
+		cfg.Compat.Highlow = DefaultHighlow
+	}
+	if cfg.Logging.Rotation == (LogRotation{}) {
+		cfg.Logging.Rotation = DefaultLogRotation
+	}
+
 	if _, err = f.Seek(0, 0); err != nil {
 		return Config{}, fmt.Errorf("error while seeking back to beginning of file: %v", err)
 	}
@@ -8,9 +8,13 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"regexp"
-	"strconv"
 	"strings"
+
+	"github.com/dankgrinder/dankgrinder/notify"
+	"github.com/sirupsen/logrus"
 )
 
 func (c Config) Validate() error {
@@ -27,12 +31,106 @@ func (c Config) Validate() error {
 			}
 		}
 	}
+	if err := c.validateRoutes(); err != nil {
+		return err
+	}
 	if err := validateCompat(c.Compat); err != nil {
 		return err
 	}
+	if c.Journal.MaximumSize < 0 {
+		return fmt.Errorf("journal: maximum size must be greater than or equal to 0")
+	}
+	if c.Journal.MaximumFiles < 0 {
+		return fmt.Errorf("journal: maximum files must be greater than or equal to 0")
+	}
+	if c.Metrics.Enable && c.Metrics.Address == "" {
+		return fmt.Errorf("metrics: no address")
+	}
+	if c.Control.Enable {
+		if c.Control.Address == "" {
+			return fmt.Errorf("control: no address")
+		}
+		if c.Control.Token == "" && !isLoopback(c.Control.Address) {
+			return fmt.Errorf("control: a token is required to listen on %v, which is not a loopback address", c.Control.Address)
+		}
+	}
+	if err := validateLogging(c.Logging); err != nil {
+		return fmt.Errorf("logging: %v", err)
+	}
+	if c.Notifications.Enable {
+		if err := validateNotifications(c.Notifications); err != nil {
+			return fmt.Errorf("notifications: %v", err)
+		}
+	}
+	return nil
+}
+
+func validateLogging(l Logging) error {
+	switch l.Format {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("invalid format: %v", l.Format)
+	}
+	r := l.Rotation
+	if r.MaximumSize < 0 || r.Interval < 0 || r.MaximumAge < 0 || r.MaximumFiles < 0 {
+		return fmt.Errorf("rotation: values must be greater than or equal to 0")
+	}
+	for component, level := range l.Levels {
+		var ok bool
+		for _, c := range LogComponents {
+			if c == component {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("levels: invalid component: %v", component)
+		}
+		if _, err := logrus.ParseLevel(level); err != nil {
+			return fmt.Errorf("levels.%v: invalid level: %v", component, level)
+		}
+	}
+	return nil
+}
+
+func validateNotifications(n Notifications) error {
+	if n.RareItemValue < 0 {
+		return fmt.Errorf("rare item value must be greater than or equal to 0")
+	}
+	for i, sink := range n.Sinks {
+		switch sink.Type {
+		case SinkTypeWebhook, SinkTypeHTTP:
+			if u, err := url.Parse(sink.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("sinks[%v].url: invalid url", i)
+			}
+		case SinkTypeCommand:
+			if sink.Command == "" {
+				return fmt.Errorf("sinks[%v].command: no command", i)
+			}
+		default:
+			return fmt.Errorf("sinks[%v].type: invalid sink type: %v", i, sink.Type)
+		}
+		for _, event := range sink.Events {
+			if !isNotificationEvent(event) {
+				return fmt.Errorf("sinks[%v].events: invalid event: %v", i, event)
+			}
+		}
+		if sink.Cooldown < 0 {
+			return fmt.Errorf("sinks[%v].cooldown: must be greater than or equal to 0", i)
+		}
+	}
 	return nil
 }
 
+func isNotificationEvent(event string) bool {
+	for _, e := range notify.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
 func validateInstance(instance Instance) error {
 	if instance.Token == "" {
 		return fmt.Errorf("no token")
@@ -55,7 +153,100 @@ func validateInstance(instance Instance) error {
 	return nil
 }
 
+// validateRoutes checks that instance names are unique within their cluster
+// and that routes only target existing instances. Routes may only target other
+// clusters if the coordinator is enabled.
+func (c Config) validateRoutes() error {
+	names := map[string]map[string]bool{}
+	for ck, cluster := range c.Clusters {
+		names[ck] = map[string]bool{}
+		for _, instance := range append(cluster.Instances, cluster.Master) {
+			if instance.Name == "" {
+				continue
+			}
+			switch instance.Name {
+			case TargetMaster, TargetPoorest, TargetRichest:
+				return fmt.Errorf("clusters[%v]: invalid instance name: %v, this name is reserved", ck, instance.Name)
+			}
+			if names[ck][instance.Name] {
+				return fmt.Errorf("clusters[%v]: duplicate instance name: %v", ck, instance.Name)
+			}
+			names[ck][instance.Name] = true
+		}
+	}
+	validateTarget := func(own, cluster, target string) error {
+		if cluster == "" {
+			cluster = own
+		}
+		if cluster != own && !c.Coordinator.Enable {
+			return fmt.Errorf("route to cluster %v requires the coordinator to be enabled", cluster)
+		}
+		if _, ok := names[cluster]; !ok {
+			return fmt.Errorf("invalid route cluster: %v", cluster)
+		}
+		switch target {
+		case "", TargetMaster, TargetPoorest, TargetRichest:
+			return nil
+		}
+		if !names[cluster][target] {
+			return fmt.Errorf("invalid route target: %v", target)
+		}
+		return nil
+	}
+	for ck, cluster := range c.Clusters {
+		for _, instance := range append(cluster.Instances, cluster.Master) {
+			for _, route := range instance.Features.AutoShare.Routes {
+				if err := validateTarget(ck, route.Cluster, route.Target); err != nil {
+					return fmt.Errorf("clusters[%v]: auto-share: %v", ck, err)
+				}
+			}
+			for _, route := range instance.Features.AutoGift.Routes {
+				if err := validateTarget(ck, route.Cluster, route.Target); err != nil {
+					return fmt.Errorf("clusters[%v]: auto-gift: %v", ck, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func validateFeatures(features Features) error {
+	if features.RemoteControl.Enable {
+		if len(features.RemoteControl.Owners) == 0 {
+			return fmt.Errorf("features.remote_control.owners: no owners")
+		}
+		for i, owner := range features.RemoteControl.Owners {
+			if !isValidID(owner) {
+				return fmt.Errorf("features.remote_control.owners[%v]: invalid user id", i)
+			}
+		}
+		if features.RemoteControl.ChannelID != "" && !isValidID(features.RemoteControl.ChannelID) {
+			return fmt.Errorf("features.remote_control.channel_id: invalid channel id")
+		}
+		if strings.ContainsAny(features.RemoteControl.Prefix, " \t\n") {
+			return fmt.Errorf("features.remote_control.prefix: must not contain whitespace")
+		}
+	}
+	for i, rule := range features.AutoBuy.Rules {
+		if _, err := regexp.Compile(rule.Pattern); rule.Pattern == "" || err != nil {
+			return fmt.Errorf("features.auto_buy.rules[%v].pattern: invalid regular expression", i)
+		}
+		if rule.Command == "" {
+			return fmt.Errorf("features.auto_buy.rules[%v].command: no command", i)
+		}
+		if rule.Item == "" {
+			return fmt.Errorf("features.auto_buy.rules[%v].item: no item", i)
+		}
+		if rule.Amount < 0 {
+			return fmt.Errorf("features.auto_buy.rules[%v].amount: value must be greater than or equal to 0", i)
+		}
+		if rule.MaximumPrice < 0 {
+			return fmt.Errorf("features.auto_buy.rules[%v].maximum_price: value must be greater than or equal to 0", i)
+		}
+		if rule.MinimumBalance < 0 {
+			return fmt.Errorf("features.auto_buy.rules[%v].minimum_balance: value must be greater than or equal to 0", i)
+		}
+	}
 	if features.AutoSell.Enable {
 		if features.AutoSell.Interval < 0 {
 			return fmt.Errorf("auto-sell interval must be greater than or equal to 0")
@@ -63,13 +254,26 @@ func validateFeatures(features Features) error {
 		if len(features.AutoSell.Items) == 0 {
 			return fmt.Errorf("auto-sell enabled but no items configured")
 		}
+		for item, n := range features.AutoSell.MinimumStock {
+			if n < 0 {
+				return fmt.Errorf("auto-sell minimum stock of %v must be greater than or equal to 0", item)
+			}
+		}
 	}
 	if features.AutoGift.Enable {
 		if features.AutoGift.Interval < 0 {
 			return fmt.Errorf("auto-gift interval must be greater than or equal to 0")
 		}
-		if len(features.AutoGift.Items) == 0 {
-			return fmt.Errorf("auto-gift enabled but no items configured")
+		if len(features.AutoGift.Items) == 0 && len(features.AutoGift.Routes) == 0 {
+			return fmt.Errorf("auto-gift enabled but no items or routes configured")
+		}
+		for i, route := range features.AutoGift.Routes {
+			if route.Item == "" {
+				return fmt.Errorf("features.auto_gift.routes[%v].item: no item", i)
+			}
+			if route.Keep < 0 || route.Maximum < 0 {
+				return fmt.Errorf("features.auto_gift.routes[%v]: keep and maximum must be greater than or equal to 0", i)
+			}
 		}
 	}
 	if features.AutoShare.Enable {
@@ -82,6 +286,41 @@ func validateFeatures(features Features) error {
 		if features.AutoShare.MinimumBalance > features.AutoShare.MaximumBalance {
 			return fmt.Errorf("auto-share minumum must be smaller than or equal to maximum")
 		}
+		for i, route := range features.AutoShare.Routes {
+			if route.Above < 0 || route.Keep < 0 || route.Maximum < 0 {
+				return fmt.Errorf("features.auto_share.routes[%v]: above, keep and maximum must be greater than or equal to 0", i)
+			}
+			if route.Keep > route.Above {
+				return fmt.Errorf("features.auto_share.routes[%v]: keep must be smaller than or equal to above", i)
+			}
+		}
+	}
+	if features.AutoBank.Enable {
+		if !features.BalanceCheck.Enable {
+			return fmt.Errorf("auto-bank enabled but balance check disabled")
+		}
+		if features.AutoBank.WalletFloat < 0 {
+			return fmt.Errorf("auto-bank wallet float must be greater than or equal to 0")
+		}
+		if features.AutoBank.DepositAbove < features.AutoBank.WalletFloat {
+			return fmt.Errorf("auto-bank deposit above must be greater than or equal to wallet float")
+		}
+	}
+	if features.AutoUse.Enable {
+		if len(features.AutoUse.Items) == 0 {
+			return fmt.Errorf("auto-use enabled but no items configured")
+		}
+		for i, item := range features.AutoUse.Items {
+			if item.Item == "" {
+				return fmt.Errorf("features.auto_use.items[%v].item: no item", i)
+			}
+			if item.Interval < 0 || item.Duration < 0 {
+				return fmt.Errorf("features.auto_use.items[%v]: interval and duration must be greater than or equal to 0", i)
+			}
+			if item.Interval == 0 && item.Duration == 0 {
+				return fmt.Errorf("features.auto_use.items[%v]: interval or duration must be greater than 0", i)
+			}
+		}
 	}
 	if features.AutoTidepod.Enable && features.AutoTidepod.Interval < 0 {
 		return fmt.Errorf("auto-tidepod interval must be greater than or equal to 0")
@@ -89,6 +328,9 @@ func validateFeatures(features Features) error {
 	if features.BalanceCheck.Enable && features.BalanceCheck.Interval <= 0 {
 		return fmt.Errorf("balance check interval must be greater than 0")
 	}
+	if features.InventoryCheck.Enable && features.InventoryCheck.Interval <= 0 {
+		return fmt.Errorf("inventory check interval must be greater than 0")
+	}
 	if features.AutoBlackjack.Enable {
 		if !features.BalanceCheck.Enable {
 			return fmt.Errorf("auto-blackjack enabled but balance check disabled")
@@ -96,20 +338,19 @@ func validateFeatures(features Features) error {
 		if features.AutoBlackjack.Amount < 0 {
 			return fmt.Errorf("auto-blackjack amount must be greater than or equal to 0")
 		}
-		for colKey, row := range features.AutoBlackjack.LogicTable {
-			if colKey != "A" {
-				n, err := strconv.Atoi(colKey)
-				if err != nil || n < 2 || n > 10 {
-					return fmt.Errorf("invalid auto-blackjack logic table key: %v", colKey)
-				}
-			}
-			for rowKey := range row {
-				rowKey = strings.Replace(rowKey, "soft", "", -1)
-				n, err := strconv.Atoi(rowKey)
-				if err != nil || n < 4 || n > 20 {
-					return fmt.Errorf("invalid auto-blackjack logic table key: %v", rowKey)
-				}
-			}
+		if features.AutoBlackjack.MaximumBalance < 0 {
+			return fmt.Errorf("auto-blackjack maximum balance must be greater than or equal to 0")
+		}
+		if features.AutoBlackjack.StopLoss < 0 {
+			return fmt.Errorf("auto-blackjack stop loss must be greater than or equal to 0")
+		}
+		if features.AutoBlackjack.TakeProfit < 0 {
+			return fmt.Errorf("auto-blackjack take profit must be greater than or equal to 0")
+		}
+		// The strategy and logic table are validated by the instance, which
+		// builds its strategy table from them when it starts.
+		if err := validateBlackjackBet(features.AutoBlackjack.Bet); err != nil {
+			return err
 		}
 	}
 
@@ -130,6 +371,35 @@ func validateFeatures(features Features) error {
 	return nil
 }
 
+func validateBlackjackBet(bet BlackjackBet) error {
+	switch bet.Strategy {
+	case "", BetStrategyFlat:
+	case BetStrategyPercentage:
+		if bet.Percentage <= 0 || bet.Percentage > 100 {
+			return fmt.Errorf("auto-blackjack bet percentage must be greater than 0 and at most 100")
+		}
+	case BetStrategyKelly:
+		if bet.KellyFraction <= 0 || bet.KellyFraction > 1 {
+			return fmt.Errorf("auto-blackjack bet kelly fraction must be greater than 0 and at most 1")
+		}
+		if bet.Minimum <= 0 {
+			return fmt.Errorf("auto-blackjack bet minimum must be greater than 0 for the kelly strategy")
+		}
+	default:
+		return fmt.Errorf("invalid auto-blackjack bet strategy: %v", bet.Strategy)
+	}
+	if bet.Minimum < 0 {
+		return fmt.Errorf("auto-blackjack bet minimum must be greater than or equal to 0")
+	}
+	if bet.Maximum < 0 {
+		return fmt.Errorf("auto-blackjack bet maximum must be greater than or equal to 0")
+	}
+	if bet.Maximum != 0 && bet.Minimum > bet.Maximum {
+		return fmt.Errorf("auto-blackjack bet minimum must be smaller than or equal to maximum")
+	}
+	return nil
+}
+
 func validateShifts(shifts []Shift) error {
 	for _, shift := range shifts {
 		if shift.State != ShiftStateActive && shift.State != ShiftStateDormant {
@@ -143,12 +413,69 @@ func validateCompat(compat Compat) error {
 	if len(compat.PostmemeOpts) == 0 {
 		return fmt.Errorf("no postmeme compatibility options")
 	}
+	switch compat.PostmemeStrategy.Strategy {
+	case "", StrategyUniform, StrategyWeighted, StrategyBestEV, StrategyEpsilonGreedy:
+	default:
+		return fmt.Errorf("invalid postmeme strategy: %v", compat.PostmemeStrategy.Strategy)
+	}
+	if compat.PostmemeStrategy.Epsilon < 0 || compat.PostmemeStrategy.Epsilon > 1 {
+		return fmt.Errorf("postmeme strategy epsilon must be from 0 up to and including 1")
+	}
+	if compat.PostmemeStrategy.MinimumSamples < 0 {
+		return fmt.Errorf("postmeme strategy minimum samples must be greater than or equal to 0")
+	}
+	for opt, weight := range compat.PostmemeStrategy.Weights {
+		if weight < 0 {
+			return fmt.Errorf("postmeme strategy weight of %v must be greater than or equal to 0", opt)
+		}
+	}
+	if compat.PostmemeStrategy.Strategy == StrategyWeighted {
+		var total float64
+		for _, opt := range compat.PostmemeOpts {
+			weight, ok := compat.PostmemeStrategy.Weights[opt]
+			if !ok {
+				weight = 1
+			}
+			total += weight
+		}
+		if total <= 0 {
+			return fmt.Errorf("postmeme strategy weights must not all be 0")
+		}
+	}
 	if len(compat.AllowedSearches) == 0 {
 		return fmt.Errorf("no allowed searches")
 	}
 	if len(compat.SearchCancel) == 0 {
 		return fmt.Errorf("no search cancel compatibility options")
 	}
+	switch compat.SearchStrategy.Strategy {
+	case "", StrategyWhitelist, StrategyBestEV, StrategyEpsilonGreedy:
+	default:
+		return fmt.Errorf("invalid search strategy: %v", compat.SearchStrategy.Strategy)
+	}
+	if compat.SearchStrategy.Epsilon < 0 || compat.SearchStrategy.Epsilon > 1 {
+		return fmt.Errorf("search strategy epsilon must be from 0 up to and including 1")
+	}
+	if compat.SearchStrategy.MinimumSamples < 0 {
+		return fmt.Errorf("search strategy minimum samples must be greater than or equal to 0")
+	}
+	if compat.Highlow.Minimum >= compat.Highlow.Maximum {
+		return fmt.Errorf("highlow minimum must be smaller than maximum")
+	}
+	if compat.Highlow.Threshold < compat.Highlow.Minimum || compat.Highlow.Threshold > compat.Highlow.Maximum {
+		return fmt.Errorf("highlow threshold must be from minimum up to and including maximum")
+	}
+	if compat.Highlow.BucketSize <= 0 {
+		return fmt.Errorf("highlow bucket size must be greater than 0")
+	}
+	if compat.ShareTax < 0 || compat.ShareTax >= 100 {
+		return fmt.Errorf("share tax must be from 0 up to but not including 100")
+	}
+	for item, price := range compat.ItemPrices {
+		if price < 0 {
+			return fmt.Errorf("item price of %v must be greater than or equal to 0", item)
+		}
+	}
 	if compat.Cooldown.Postmeme <= 0 {
 		return fmt.Errorf("postmeme cooldown must be greater than 0")
 	}
@@ -188,3 +515,17 @@ func validateCompat(compat Compat) error {
 func isValidID(id string) bool {
 	return regexp.MustCompile(`^[0-9]+$`).Match([]byte(id))
 }
+
+// isLoopback returns true if the host of addr is a loopback address or
+// localhost. An empty host listens on all interfaces, so it is not.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
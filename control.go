@@ -0,0 +1,25 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/dankgrinder/dankgrinder/control"
+	"github.com/dankgrinder/dankgrinder/instance"
+	"github.com/sirupsen/logrus"
+)
+
+// serveControl serves the control API and status page for ins at addr. It does
+// not return unless the server fails.
+func serveControl(addr, token string, ins []*instance.Instance) {
+	srv := &control.Server{Instances: ins, Token: token, Address: addr}
+	logrus.Infof("serving status page on http://%v", addr)
+	if err := http.ListenAndServe(addr, srv.Handler()); err != nil {
+		logrus.Errorf("error while serving control api: %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+// Package control serves a local HTTP API to inspect and control running
+// instances, and a status page which uses it.
+package control
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/instance"
+)
+
+// Server serves the control API for Instances.
+type Server struct {
+	Instances []*instance.Instance
+
+	// Token is the bearer token required for all API requests. If it is
+	// empty, requests are not authenticated, which is only safe when listening
+	// on a loopback address.
+	Token string
+
+	// Address is the address the server listens on. Without a token, only
+	// requests with the host of Address or a loopback host are served.
+	Address string
+}
+
+// Cluster is a cluster with the status of its instances.
+type Cluster struct {
+	Name      string            `json:"name"`
+	Instances []instance.Status `json:"instances"`
+}
+
+// Handler returns the http.Handler of the control API and status page.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.page)
+	mux.HandleFunc("/api/clusters", s.authorized(s.clusters))
+	mux.HandleFunc("/api/instances/", s.authorized(s.instance))
+	return s.checkHost(mux)
+}
+
+// checkHost returns a handler which calls h if the server has a token, or if
+// the host of the request is the host of the server's address or a loopback
+// host. A website can make the browser send same-origin requests to a loopback
+// address by resolving its own domain to it, but the host of these requests
+// is still the website's domain.
+func (s *Server) checkHost(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Token == "" && !s.allowedHost(r.Host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("host not allowed: %v", r.Host))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) allowedHost(hostport string) bool {
+	host := hostname(hostport)
+	if host == "" {
+		return false
+	}
+	if addr := hostname(s.Address); addr != "" && strings.EqualFold(host, addr) {
+		return true
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// hostname returns the host of hostport without the port and the brackets
+// around IPv6 addresses.
+func hostname(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]")
+}
+
+// authorized returns a handler which calls h if the request carries the bearer
+// token of the server, if any. POST requests must also have a JSON body. Other
+// websites can make the browser send POST requests to the API, but not with a
+// JSON content type unless the API allows them to.
+func (s *Server) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Token != "" {
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, "Bearer ") ||
+				subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(s.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid or missing token"))
+				return
+			}
+		}
+		if r.Method == http.MethodPost {
+			if ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || ct != "application/json" {
+				writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("content type must be application/json"))
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+// Clusters returns the status of all instances grouped by cluster, sorted by
+// name.
+func (s *Server) Clusters() []Cluster {
+	m := map[string]*Cluster{}
+	var names []string
+	for _, in := range s.Instances {
+		status := in.Status()
+		if m[status.Cluster] == nil {
+			m[status.Cluster] = &Cluster{Name: status.Cluster}
+			names = append(names, status.Cluster)
+		}
+		m[status.Cluster].Instances = append(m[status.Cluster].Instances, status)
+	}
+	sort.Strings(names)
+	clusters := []Cluster{}
+	for _, name := range names {
+		clusters = append(clusters, *m[name])
+	}
+	return clusters
+}
+
+// Find returns the instance with key as user id, name or username. Names and
+// usernames are compared case-insensitively.
+func (s *Server) Find(key string) (*instance.Instance, bool) {
+	for _, in := range s.Instances {
+		if in.Client.User.ID == key {
+			return in, true
+		}
+	}
+	for _, in := range s.Instances {
+		if (in.Name != "" && strings.EqualFold(in.Name, key)) ||
+			strings.EqualFold(in.Client.User.Username, key) {
+			return in, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) page(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, page)
+}
+
+func (s *Server) clusters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Clusters())
+}
+
+// instance serves /api/instances/{key} and /api/instances/{key}/{action}, where
+// key is anything accepted by Find.
+func (s *Server) instance(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/instances/"), "/"), "/")
+	in, ok := s.Find(parts[0])
+	if !ok || len(parts) > 2 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("instance not found"))
+		return
+	}
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+
+	method := http.MethodPost
+	if action == "" || action == "queue" {
+		method = http.MethodGet
+	}
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+
+	switch action {
+	case "":
+		writeJSON(w, http.StatusOK, in.Status())
+	case "queue":
+		writeJSON(w, http.StatusOK, map[string][]string{"queued": in.Queued()})
+	case "pause":
+		in.Pause()
+		writeJSON(w, http.StatusOK, in.Status())
+	case "resume":
+		in.Resume()
+		writeJSON(w, http.StatusOK, in.Status())
+	case "shift":
+		var body struct {
+			State    string `json:"state"`
+			Duration int    `json:"duration"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("error while decoding body: %v", err))
+			return
+		}
+		if err := in.ForceShift(body.State, time.Duration(body.Duration)*time.Second); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, in.Status())
+	case "commands":
+		var body struct {
+			Value string `json:"value"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("error while decoding body: %v", err))
+			return
+		}
+		if err := in.Run(body.Value); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string][]string{"queued": in.Queued()})
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown action: %v", action))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
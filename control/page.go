@@ -0,0 +1,123 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package control
+
+// page is the status page. It polls the control API and renders a table per
+// cluster, with buttons for the actions of the API.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Dank Grinder</title>
+<style>
+body { font-family: sans-serif; margin: 2em; background: #f6f6f6; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; background: #fff; }
+th, td { padding: .4em .8em; border-bottom: 1px solid #ddd; text-align: left; }
+td.n { text-align: right; font-variant-numeric: tabular-nums; }
+.active { color: #1a7f37; }
+.dormant { color: #888; }
+.paused, .closed, #error { color: #cf222e; }
+button { margin-right: .2em; }
+</style>
+</head>
+<body>
+<h1>Dank Grinder</h1>
+<p id="error"></p>
+<div id="clusters"></div>
+<script>
+const fmt = n => n.toLocaleString();
+
+function left(end) {
+  const t = new Date(end);
+  if (t.getFullYear() < 2000) return "";
+  const s = Math.max(0, Math.round((t - Date.now()) / 1000));
+  return Math.floor(s / 3600) + "h " + Math.floor(s % 3600 / 60) + "m";
+}
+
+function esc(s) {
+  const d = document.createElement("div");
+  d.textContent = s;
+  return d.innerHTML;
+}
+
+// The token is passed to the page as the token query parameter.
+const token = new URLSearchParams(location.search).get("token");
+
+function api(path, opts) {
+  opts = opts || {};
+  opts.headers = opts.headers || {};
+  if (token) opts.headers["Authorization"] = "Bearer " + token;
+  return fetch(path, opts);
+}
+
+async function call(id, action, body) {
+  const res = await api("/api/instances/" + id + "/" + action, {
+    method: "POST",
+    headers: {"Content-Type": "application/json"},
+    body: body ? JSON.stringify(body) : undefined,
+  });
+  const data = await res.json();
+  if (data.error) alert(data.error);
+  refresh();
+}
+
+function shift(id, state) {
+  const min = prompt("Force a " + state + " shift for how many minutes?", "60");
+  if (min) call(id, "shift", {state: state, duration: Math.round(parseFloat(min) * 60)});
+}
+
+function run(id) {
+  const value = prompt("Command to send:");
+  if (value) call(id, "commands", {value: value});
+}
+
+async function queue(id) {
+  const res = await api("/api/instances/" + id + "/queue");
+  const data = await res.json();
+  alert((data.queued || []).join("\n") || "The queue is empty.");
+}
+
+async function refresh() {
+  let clusters;
+  try {
+    clusters = await (await api("/api/clusters")).json();
+    document.getElementById("error").textContent = "";
+  } catch (err) {
+    document.getElementById("error").textContent = "Could not reach Dank Grinder: " + err;
+    return;
+  }
+  let html = "";
+  for (const c of clusters) {
+    html += "<h2>" + esc(c.name) + "</h2><table><tr><th>Instance</th><th>State</th><th>Time left</th>" +
+      "<th>Wallet</th><th>Bank</th><th>Net worth</th><th>Queued</th><th>Postmeme</th><th></th></tr>";
+    for (const i of c.instances) {
+      let state = '<span class="' + i.state + '">' + (i.state || "starting") + "</span>";
+      if (i.paused) state += ' <span class="paused">paused</span>';
+      if (i.closed) state = '<span class="closed">closed</span>';
+      html += "<tr><td>" + esc(i.username) + (i.name ? " (" + esc(i.name) + ")" : "") + (i.master ? " &#9733;" : "") + "</td>" +
+        "<td>" + state + "</td><td>" + left(i.shift_end) + "</td>" +
+        '<td class="n">' + fmt(i.balance) + '</td><td class="n">' + fmt(i.bank) + '</td><td class="n">' + fmt(i.net_worth) + "</td>" +
+        '<td class="n"><a href="#" onclick="queue(\'' + i.id + '\'); return false">' + i.queued + "</a></td>" +
+        "<td>" + (i.postmeme || []).map(p => esc(p.choice) + " " + fmt(p.expected_value) + " (" + p.samples + ")").join(", ") + "</td><td>" +
+        (i.paused
+          ? "<button onclick=\"call('" + i.id + "', 'resume')\">Resume</button>"
+          : "<button onclick=\"call('" + i.id + "', 'pause')\">Pause</button>") +
+        "<button onclick=\"shift('" + i.id + "', 'active')\">Force active</button>" +
+        "<button onclick=\"shift('" + i.id + "', 'dormant')\">Force dormant</button>" +
+        "<button onclick=\"run('" + i.id + "')\">Run command</button></td></tr>";
+    }
+    html += "</table>";
+  }
+  document.getElementById("clusters").innerHTML = html;
+}
+
+refresh();
+setInterval(refresh, 5000);
+</script>
+</body>
+</html>
+`
@@ -15,9 +15,11 @@ import (
 type MessageRouter struct {
 	routes     []*MessageRoute
 	middleware []func(h HandlerFunc) HandlerFunc
+	observers  []ObserverFunc
 }
 
 type MessageRoute struct {
+	name    string
 	conds   []condFunc
 	handler HandlerFunc
 }
@@ -25,7 +27,13 @@ type MessageRoute struct {
 type HandlerFunc func(msg Message)
 type condFunc func(msg Message, eventType string) bool
 
+// ObserverFunc is called for every message processed by a router, after the
+// handlers of the matching routes were called. routes holds the names of those
+// routes in order.
+type ObserverFunc func(msg Message, eventType string, routes []string)
+
 func (rtr *MessageRouter) process(msg Message, eventType string) {
+	var matched []string
 	for _, rt := range rtr.routes {
 		if rt.matches(msg, eventType) {
 			h := rt.handler
@@ -33,8 +41,12 @@ func (rtr *MessageRouter) process(msg Message, eventType string) {
 				h = mw(h)
 			}
 			h(msg)
+			matched = append(matched, rt.name)
 		}
 	}
+	for _, obs := range rtr.observers {
+		obs(msg, eventType, matched)
+	}
 }
 
 func (rt *MessageRoute) matches(msg Message, eventType string) bool {
@@ -58,6 +70,17 @@ func (rtr *MessageRouter) Middleware(mw func(h HandlerFunc) HandlerFunc) {
 	rtr.middleware = append(rtr.middleware, mw)
 }
 
+// Observe adds an observer which is called for every processed message.
+func (rtr *MessageRouter) Observe(obs ObserverFunc) {
+	rtr.observers = append(rtr.observers, obs)
+}
+
+// Name sets the name by which observers refer to the route.
+func (rt *MessageRoute) Name(name string) *MessageRoute {
+	rt.name = name
+	return rt
+}
+
 func (rt *MessageRoute) EventType(et string) *MessageRoute {
 	rt.conds = append(rt.conds, func(_ Message, eventType string) bool {
 		return eventType == et
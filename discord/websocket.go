@@ -9,6 +9,7 @@ package discord
 import (
 	"encoding/json"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -27,6 +28,12 @@ type WSConn struct {
 	client       Client
 	seq          int
 	closePinger  chan struct{}
+
+	// lastHeartbeat is the time at which the last heartbeat was sent and
+	// latency the time it took until it was acknowledged, both in nanoseconds.
+	// They are accessed atomically.
+	lastHeartbeat int64
+	latency       int64
 }
 
 type WSConnOpts struct {
@@ -131,6 +138,10 @@ func (c *WSConn) listen() {
 				body.EventName == EventNameMessageUpdate {
 				go c.rtr.process(body.Data.Message, body.EventName)
 			}
+		case OpcodeHeartbeatACK:
+			if sent := atomic.LoadInt64(&c.lastHeartbeat); sent != 0 {
+				atomic.StoreInt64(&c.latency, time.Now().UnixNano()-sent)
+			}
 		case OpcodeInvalidSession:
 			c.fatalHandler(fmt.Errorf("session invalidated"))
 			c.Close()
@@ -151,6 +162,7 @@ func (c *WSConn) ping(interval time.Duration) {
 				return
 			case <-t.C:
 			}
+			atomic.StoreInt64(&c.lastHeartbeat, time.Now().UnixNano())
 			_ = c.underlying.WriteJSON(&Event{
 				Op: OpcodeHeartbeat,
 			})
@@ -200,6 +212,12 @@ func (c *WSConn) awaitEvent(e string) error {
 	return nil
 }
 
+// Latency returns the time it took for the last heartbeat to be acknowledged.
+// It is 0 if no heartbeat was acknowledged yet.
+func (c *WSConn) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.latency))
+}
+
 func (c *WSConn) Close() error {
 	c.fatalHandler = func(err error) {}
 	c.rtr.routes = nil
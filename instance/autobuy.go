@@ -7,55 +7,86 @@
 package instance
 
 import (
+	"fmt"
+	"strconv"
+
+	"github.com/dankgrinder/dankgrinder/config"
 	"github.com/dankgrinder/dankgrinder/discord"
 	"github.com/dankgrinder/dankgrinder/instance/scheduler"
 )
 
-func (in *Instance) abLaptop(_ discord.Message) {
-	trigger := in.sdlr.AwaitResumeTrigger()
-	if trigger == nil || trigger.Value != postmemeCmdValue {
-		return
-	}
-	in.sdlr.ResumeWithCommand(&scheduler.Command{
-		Value: buyCmdValue("1", "laptop"),
-		Log:   "no laptop, buying a new one",
-	})
-}
+// autoBuy returns a handler which buys the item of rule if the message responds
+// to the rule's command. This is the case if the scheduler is awaiting a resume
+// because of the command, or, for commands which do not await a resume such as
+// custom commands, if the message replies to the command. The purchase is
+// skipped if the item costs more than the maximum price or if the balance would
+// drop below the minimum balance. Buy prices are only known for items that were
+// looked up in the shop. If the price is unknown but needed for these limits,
+// the purchase is skipped and the item is looked up instead, so it can be bought
+// the next time.
+func (in *Instance) autoBuy(rule config.AutoBuyRule) func(msg discord.Message) {
+	return func(msg discord.Message) {
+		trigger := in.sdlr.AwaitResumeTrigger()
+		awaiting := trigger != nil && trigger.Value == rule.Command
+		if !awaiting && !in.repliesTo(msg, rule.Command) {
+			return
+		}
+		amount := rule.Amount
+		if amount == 0 {
+			amount = 1
+		}
+		price, known := in.prices.buyPrice(rule.ShopKey())
+		limited := rule.MaximumPrice != 0 || rule.MinimumBalance != 0
+		if !known && limited {
+			in.Logger.Infof("not buying %v, price unknown, looking it up in the shop", rule.Item)
+			lookup := &scheduler.Command{
+				Value: shopCmdValue(rule.Item),
+				Log:   fmt.Sprintf("looking up price of %v", rule.Item),
+			}
+			if awaiting {
+				in.sdlr.ResumeWithCommand(lookup)
+			} else {
+				in.sdlr.PrioritySchedule(lookup)
+			}
+			return
+		}
+		skip := ""
+		if rule.MaximumPrice != 0 && price > rule.MaximumPrice {
+			skip = fmt.Sprintf("price of %v coins is above maximum", numFmt.Sprintf("%d", price))
+		} else if in.balance-price*amount < rule.MinimumBalance {
+			skip = "balance would drop below minimum"
+		}
+		if skip != "" {
+			in.Logger.Infof("not buying %v, %v", rule.Item, skip)
+			if awaiting {
+				in.sdlr.Resume()
+			}
+			return
+		}
 
-func (in *Instance) abHuntingRifle(_ discord.Message) {
-	trigger := in.sdlr.AwaitResumeTrigger()
-	if trigger == nil || trigger.Value != huntCmdValue {
-		return
+		buy := &scheduler.Command{
+			Value: buyCmdValue(strconv.Itoa(amount), rule.Item),
+			Log:   fmt.Sprintf("no %v, buying %v", rule.Item, amount),
+		}
+		if awaiting {
+			in.sdlr.ResumeWithCommand(buy)
+		} else {
+			in.sdlr.PrioritySchedule(buy)
+		}
+		if rule.Retry {
+			in.sdlr.Schedule(&scheduler.Command{
+				Value:       rule.Command,
+				Log:         fmt.Sprintf("retrying command after buying %v", rule.Item),
+				AwaitResume: awaiting && trigger.AwaitResume,
+			})
+		}
 	}
-	in.sdlr.ResumeWithCommand(&scheduler.Command{
-		Value: buyCmdValue("1", "rifle"),
-		Log:   "no hunting rifle, buying a new one",
-	})
 }
 
-func (in *Instance) abFishingPole(_ discord.Message) {
-	trigger := in.sdlr.AwaitResumeTrigger()
-	if trigger == nil || trigger.Value != fishCmdValue {
-		return
-	}
-	in.sdlr.ResumeWithCommand(&scheduler.Command{
-		Value: buyCmdValue("1", "fishing"),
-		Log:   "no fishing pole, buying a new one",
-	})
-}
-
-func (in *Instance) abTidepod(_ discord.Message) {
-	trigger := in.sdlr.AwaitResumeTrigger()
-	if trigger == nil || trigger.Value != tidepodCmdValue {
-		return
-	}
-	in.sdlr.Schedule(&scheduler.Command{
-		Value: buyCmdValue("1", "tide"),
-		Log:   "no tidepod, buying a new one",
-	})
-	in.sdlr.Schedule(&scheduler.Command{
-		Value:       tidepodCmdValue,
-		Log:         "retrying tidepod usage after last unavailability",
-		AwaitResume: true,
-	})
+// repliesTo returns true if msg replies to a message of the instance's user with
+// content cmd.
+func (in *Instance) repliesTo(msg discord.Message, cmd string) bool {
+	return msg.ReferencedMessage != nil &&
+		msg.ReferencedMessage.Author.ID == in.Client.User.ID &&
+		msg.ReferencedMessage.Content == cmd
 }
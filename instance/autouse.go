@@ -0,0 +1,138 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/config"
+	"github.com/dankgrinder/dankgrinder/discord"
+	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+)
+
+// effects keeps track of the items of which the effect is active, and until
+// when.
+type effects struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+func (e *effects) activate(item string, d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.expires == nil {
+		e.expires = map[string]time.Time{}
+	}
+	e.expires[item] = time.Now().Add(d)
+}
+
+func (e *effects) isActive(item string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Now().Before(e.expires[item])
+}
+
+// ActiveEffects returns the items of which the effect is active, mapped to the
+// time at which the effect expires.
+func (in *Instance) ActiveEffects() map[string]time.Time {
+	in.effects.mu.Lock()
+	defer in.effects.mu.Unlock()
+	res := map[string]time.Time{}
+	for item, t := range in.effects.expires {
+		if time.Now().Before(t) {
+			res[item] = t
+		}
+	}
+	return res
+}
+
+func (in *Instance) newAutoUseCmds() []*scheduler.Command {
+	var cmds []*scheduler.Command
+	for _, item := range in.Features.AutoUse.Items {
+		item := item
+		interval := item.Interval
+		if interval == 0 {
+			interval = item.Duration
+		}
+		cmds = append(cmds, &scheduler.Command{
+			Value:       useCmdValue(item.Item),
+			Log:         "using " + item.Item,
+			Interval:    time.Duration(interval) * time.Second,
+			AwaitResume: true,
+			CondFunc: func() bool {
+				return !in.effects.isActive(item.Item)
+			},
+		})
+	}
+	return cmds
+}
+
+// autoUseItem returns the auto-use item that cmd uses. The second return value
+// is false if cmd does not use an auto-use item.
+func (in *Instance) autoUseItem(cmd string) (config.AutoUseItem, bool) {
+	for _, item := range in.Features.AutoUse.Items {
+		if cmd == useCmdValue(item.Item) {
+			return item, true
+		}
+	}
+	return config.AutoUseItem{}, false
+}
+
+// autoUse handles the response to using an item. Missing items are bought if
+// configured and prompts are confirmed. Any other response is taken as a
+// successful use, after which the item's effect is active for its duration.
+// Responses to other users are ignored.
+func (in *Instance) autoUse(msg discord.Message) {
+	if !in.isAddressed(msg) {
+		return
+	}
+	trigger := in.sdlr.AwaitResumeTrigger()
+	if trigger == nil {
+		return
+	}
+	item, ok := in.autoUseItem(trigger.Value)
+	if !ok {
+		return
+	}
+	content := msg.Content
+	if len(msg.Embeds) > 0 {
+		content += "\n" + msg.Embeds[0].Description
+	}
+
+	switch {
+	case strings.Contains(content, "You don't own this item"):
+		if !item.Buy {
+			in.Logger.Infof("no %v, not using it", item.Item)
+			in.sdlr.Resume()
+			return
+		}
+		in.sdlr.ResumeWithCommand(&scheduler.Command{
+			Value: buyCmdValue("1", item.Item),
+			Log:   "no " + item.Item + ", buying a new one",
+		})
+		in.sdlr.Schedule(&scheduler.Command{
+			Value:       trigger.Value,
+			Log:         "retrying usage of " + item.Item + " after buying it",
+			AwaitResume: true,
+		})
+	case exp.usePrompt.MatchString(content):
+		// The effect starts once the prompt is confirmed. Like for tidepods,
+		// the response to the confirmation is not awaited, so the effect is
+		// marked active right away.
+		in.effects.activate(item.Item, time.Duration(item.Duration)*time.Second)
+		in.sdlr.ResumeWithCommand(&scheduler.Command{
+			Value: acceptTidepodCmdValue,
+			Log:   "confirming usage of " + item.Item,
+		})
+	default:
+		in.effects.activate(item.Item, time.Duration(item.Duration)*time.Second)
+		in.sdlr.Resume()
+		in.Logger.Infof("used %v", item.Item)
+	}
+}
@@ -7,14 +7,12 @@
 package instance
 
 import (
-	"fmt"
 	"math"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/dankgrinder/dankgrinder/instance/scheduler"
-
 	"github.com/dankgrinder/dankgrinder/discord"
 )
 
@@ -31,41 +29,93 @@ func (in *Instance) balanceCheck(msg discord.Message) {
 		in.Logger.Errorf("error while reading balance: %v", err)
 		return
 	}
+	if match := exp.bank.FindStringSubmatch(msg.Embeds[0].Description); match != nil {
+		bank, err := strconv.Atoi(strings.Replace(match[1], ",", "", -1))
+		if err != nil {
+			in.Logger.Errorf("error while reading bank balance: %v", err)
+			return
+		}
+		in.mu.Lock()
+		in.bank = bank
+		in.mu.Unlock()
+		if match[2] != "" {
+			in.bankCapacity, _ = strconv.Atoi(strings.Replace(match[2], ",", "", -1))
+		}
+	}
 	in.updateBalance(balance)
 }
 
 func (in *Instance) updateBalance(balance int) {
-	if balance > in.Features.AutoShare.MaximumBalance &&
-		in.Features.AutoShare.Enable &&
-		in.Master != nil &&
-		in != in.Master {
-		in.sdlr.PrioritySchedule(&scheduler.Command{
-			Value: fmt.Sprintf(
-				"pls share %v <@%v>",
-				balance-in.Features.AutoShare.MinimumBalance,
-				in.Master.Client.User.ID,
-			),
-			Log: "sharing all balance above minimum with master instance",
-		})
+	var sharing bool
+	if in.Features.AutoShare.Enable {
+		sharing = in.autoShare(balance)
 	}
+	in.mu.Lock()
 	in.balance = balance
 	in.lastBalanceUpdate = time.Now()
+	in.mu.Unlock()
+	atomic.StoreInt32(&in.fundingPending, 0)
+	value, unpriced := in.inventoryValue()
+	netWorth := balance + in.bank + value
 	in.Logger.Infof(
-		"current wallet balance: %v coins",
+		"current wallet balance: %v coins, bank balance: %v/%v coins, net worth: %v coins",
 		numFmt.Sprintf("%d", balance),
+		numFmt.Sprintf("%d", in.bank),
+		numFmt.Sprintf("%d", in.bankCapacity),
+		numFmt.Sprintf("%d", netWorth),
 	)
+	if unpriced > 0 {
+		in.Logger.Debugf("net worth excludes %v items with an unknown price", unpriced)
+	}
+	if fields := in.incomeFields(); len(fields) > 0 {
+		in.Logger.WithFields(fields).Infof("average income per source in coins/h")
+	}
+	if in.Features.Commands.Postmeme {
+		in.Logger.WithFields(in.postmemeStats.summary()).Infof("average postmeme income per meme type")
+	}
+	if in.Features.Commands.Highlow {
+		in.Logger.WithFields(in.highlowStats.summary()).Infof("highlow win rate per hint range")
+	}
 
+	now := time.Now()
+	if !in.startingTime.IsZero() {
+		per := now.Sub(in.startingTime).Hours()
+		hourly := func(inc int, per float64) string {
+			return numFmt.Sprintf("%d", int(math.Round(float64(inc)/per)))
+		}
+		netWorthRate := "unknown"
+		if !in.netWorthSince.IsZero() {
+			netWorthRate = hourly(netWorth-in.initialNetWorth, now.Sub(in.netWorthSince).Hours())
+		}
+		in.Logger.Infof(
+			"average income: wallet %v coins/h, bank %v coins/h, net worth %v coins/h",
+			hourly(balance-in.initialBalance, per),
+			hourly(in.bank-in.initialBank, per),
+			netWorthRate,
+		)
+	}
+	var save bool
 	if in.startingTime.IsZero() {
 		in.initialBalance = balance
-		in.startingTime = time.Now()
-		return
+		in.initialBank = in.bank
+		in.startingTime = now
+		save = true
+	}
+	// The value of the inventory owned before is not income, so the net worth
+	// is only taken as a baseline once the inventory has been read.
+	if in.netWorthSince.IsZero() && (!in.inventory.LastUpdate().IsZero() || !in.Features.InventoryCheck.Enable) {
+		in.initialNetWorth = netWorth
+		in.netWorthSince = now
+		save = true
+	}
+	if save {
+		in.saveIncome()
 	}
 
-	inc := balance - in.initialBalance
-	per := time.Now().Sub(in.startingTime)
-	hourlyInc := int(math.Round(float64(inc) / per.Hours()))
-	in.Logger.Infof(
-		"average income: %v coins/h",
-		numFmt.Sprintf("%d", hourlyInc),
-	)
+	// Coins above the threshold of a share route are shared, so they should
+	// not be deposited as well.
+	if in.Features.AutoBank.Enable && !sharing {
+		in.autoBank()
+	}
+	in.saveBalance()
 }
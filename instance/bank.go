@@ -0,0 +1,79 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"strconv"
+
+	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+)
+
+// requiredBalance returns the highest balance below which an enabled command is
+// paused.
+func (in *Instance) requiredBalance() int {
+	var req int
+	if in.Features.AutoBlackjack.Enable && in.Features.AutoBlackjack.PauseBelowBalance > req {
+		req = in.Features.AutoBlackjack.PauseBelowBalance
+	}
+	for _, cmd := range in.Features.CustomCommands {
+		if cmd.PauseBelowBalance > req {
+			req = cmd.PauseBelowBalance
+		}
+	}
+	return req
+}
+
+// walletTarget returns the amount of coins that auto-bank keeps in the wallet.
+func (in *Instance) walletTarget() int {
+	target := in.Features.AutoBank.WalletFloat
+	if req := in.requiredBalance(); req > target {
+		target = req
+	}
+	return target
+}
+
+// autoBank deposits the coins above the wallet target if the wallet balance is
+// above the deposit threshold, or withdraws enough coins to reach the wallet
+// target if a command would otherwise be paused. The balances are updated as if
+// the command already succeeded, so the same coins are not moved twice before
+// the next balance check.
+func (in *Instance) autoBank() {
+	target := in.walletTarget()
+	switch {
+	case in.balance > in.Features.AutoBank.DepositAbove && in.balance > target:
+		amount := in.balance - target
+		if in.bankCapacity > 0 {
+			if space := in.bankCapacity - in.bank; amount > space {
+				amount = space
+			}
+		}
+		if amount <= 0 {
+			return
+		}
+		in.sdlr.PrioritySchedule(&scheduler.Command{
+			Value: depositCmdValue(strconv.Itoa(amount)),
+			Log:   "depositing coins above the wallet float",
+		})
+		in.mu.Lock()
+		in.balance -= amount
+		in.bank += amount
+		in.mu.Unlock()
+	case in.balance < in.requiredBalance() && in.bank > 0:
+		amount := target - in.balance
+		if amount > in.bank {
+			amount = in.bank
+		}
+		in.sdlr.PrioritySchedule(&scheduler.Command{
+			Value: withdrawCmdValue(strconv.Itoa(amount)),
+			Log:   "withdrawing coins to prevent commands from pausing",
+		})
+		in.mu.Lock()
+		in.balance += amount
+		in.bank -= amount
+		in.mu.Unlock()
+	}
+}
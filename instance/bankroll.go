@@ -0,0 +1,220 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dankgrinder/dankgrinder/analytics"
+	"github.com/dankgrinder/dankgrinder/config"
+)
+
+const blackjackRecordName = "blackjack"
+
+// minKellySamples is the amount of games of which the bet is known required
+// before the Kelly bet strategy trusts the observed results. Until then the
+// minimum bet is used.
+const minKellySamples = 50
+
+const (
+	blackjackWin  = "win"
+	blackjackLoss = "loss"
+	blackjackPush = "push"
+)
+
+// blackjackRecord holds the results of a series of blackjack games.
+type blackjackRecord struct {
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+	Pushes int `json:"pushes"`
+
+	// Net is the amount of coins won minus the amount of coins lost.
+	Net int `json:"net"`
+
+	// Games is the amount of games of which the bet is known. Returns and
+	// SquaredReturns are the sum and the sum of squares of the net results of
+	// these games per coin bet.
+	Games          int     `json:"games"`
+	Returns        float64 `json:"returns"`
+	SquaredReturns float64 `json:"squared_returns"`
+}
+
+// bankroll keeps track of the blackjack results of the current session, which
+// lasts for one active shift, and of all sessions in total.
+type bankroll struct {
+	mu      sync.Mutex
+	session blackjackRecord
+	total   blackjackRecord
+
+	// bet is the amount bet on the current game, or 0 if it is unknown.
+	bet int
+}
+
+func (r *blackjackRecord) add(outcome string, amount, bet int) {
+	net := 0
+	switch outcome {
+	case blackjackWin:
+		r.Wins++
+		net = amount
+	case blackjackLoss:
+		r.Losses++
+		net = -amount
+	default:
+		r.Pushes++
+	}
+	r.Net += net
+	if bet > 0 {
+		ret := float64(net) / float64(bet)
+		r.Games++
+		r.Returns += ret
+		r.SquaredReturns += ret * ret
+	}
+}
+
+func (r blackjackRecord) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"wins":   r.Wins,
+		"losses": r.Losses,
+		"pushes": r.Pushes,
+		"net":    r.Net,
+	}
+}
+
+// placeBet sets the amount bet on the game that is started next. It is unknown
+// if bet is not a number, for example if the maximum is bet.
+func (br *bankroll) placeBet(bet string) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.bet, _ = strconv.Atoi(bet)
+}
+
+func (br *bankroll) record(outcome string, amount int) (session, total blackjackRecord) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.session.add(outcome, amount, br.bet)
+	br.total.add(outcome, amount, br.bet)
+	br.bet = 0
+	return br.session, br.total
+}
+
+// newSession resets the session record and returns the record of the session
+// that ended.
+func (br *bankroll) newSession() blackjackRecord {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	prev := br.session
+	br.session = blackjackRecord{}
+	return prev
+}
+
+func (br *bankroll) records() (session, total blackjackRecord) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	return br.session, br.total
+}
+
+// startBlackjackSession starts a new blackjack session and logs the results of
+// the previous one, if any games were played in it.
+func (in *Instance) startBlackjackSession() {
+	prev := in.bankroll.newSession()
+	if prev.Wins+prev.Losses+prev.Pushes > 0 {
+		in.Logger.WithFields(prev.fields()).Infof("blackjack session ended")
+	}
+}
+
+// blackjackSessionOver returns true if the stop-loss or take-profit limit of the
+// current session has been reached.
+func (in *Instance) blackjackSessionOver() bool {
+	session, _ := in.bankroll.records()
+	if sl := in.Features.AutoBlackjack.StopLoss; sl > 0 && session.Net <= -sl {
+		return true
+	}
+	if tp := in.Features.AutoBlackjack.TakeProfit; tp > 0 && session.Net >= tp {
+		return true
+	}
+	return false
+}
+
+// blackjackBroke returns true if the balance is too low to play another game of
+// blackjack.
+func (in *Instance) blackjackBroke() bool {
+	ab := in.Features.AutoBlackjack
+	return in.balance <= 0 || in.balance < ab.PauseBelowBalance || in.balance < ab.Bet.Minimum
+}
+
+// blackjackBet returns the amount to bet on the next game of blackjack based on
+// the configured bet strategy. An empty string is returned if nothing should be
+// bet.
+func (in *Instance) blackjackBet() string {
+	bet := in.Features.AutoBlackjack.Bet
+	var amount float64
+	switch bet.Strategy {
+	case config.BetStrategyPercentage:
+		amount = float64(in.balance) * bet.Percentage / 100
+	case config.BetStrategyKelly:
+		// Blackjack wins slightly less than half of the decided games, but
+		// makes up for it with payouts above even money and doubled bets, so
+		// the win rate alone says little about the edge. For a bet with a
+		// small edge, the Kelly criterion is approximately the expected net
+		// result per coin bet divided by its second moment, both of which are
+		// measured from the results of past games. The minimum is bet if the
+		// measured edge is negative.
+		_, total := in.bankroll.records()
+		if total.Games >= minKellySamples && total.SquaredReturns > 0 {
+			amount = float64(in.balance) * total.Returns / total.SquaredReturns * bet.KellyFraction
+		}
+	default:
+		if in.Features.AutoBlackjack.Amount == 0 {
+			if bet.Maximum == 0 {
+				return "max"
+			}
+			return strconv.Itoa(bet.Maximum)
+		}
+		amount = float64(in.Features.AutoBlackjack.Amount)
+	}
+	res := int(math.Floor(amount))
+	if res < bet.Minimum {
+		res = bet.Minimum
+	}
+	if bet.Maximum != 0 && res > bet.Maximum {
+		res = bet.Maximum
+	}
+	if res <= 0 {
+		return ""
+	}
+	return strconv.Itoa(res)
+}
+
+// blackjackResult records the outcome of a finished game of blackjack from the
+// description of its embed.
+func (in *Instance) blackjackResult(desc string) {
+	outcome, amount := blackjackPush, 0
+	if match := exp.blackjackResult.FindStringSubmatch(desc); match != nil {
+		outcome = blackjackWin
+		if strings.ToLower(match[1]) == "lost" {
+			outcome = blackjackLoss
+		}
+		amount, _ = strconv.Atoi(strings.Replace(match[2], ",", "", -1))
+	}
+	session, total := in.bankroll.record(outcome, amount)
+	switch outcome {
+	case blackjackWin:
+		in.recordIncome(analytics.SourceBlackjack, amount, 0)
+	case blackjackLoss:
+		in.recordIncome(analytics.SourceBlackjack, -amount, 0)
+	}
+	in.Logger.WithFields(session.fields()).Infof("blackjack %v, session results", outcome)
+	if err := in.save(blackjackRecordName, total); err != nil {
+		in.Logger.Errorf("error while saving blackjack record: %v", err)
+	}
+	if in.blackjackSessionOver() {
+		in.Logger.Infof("blackjack stop-loss or take-profit reached, pausing blackjack until the next active shift")
+	}
+}
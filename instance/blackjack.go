@@ -7,82 +7,142 @@
 package instance
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 
-	"github.com/dankgrinder/dankgrinder/instance/scheduler"
-
 	"github.com/dankgrinder/dankgrinder/discord"
+	"github.com/dankgrinder/dankgrinder/instance/blackjack"
+	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+	"github.com/dankgrinder/dankgrinder/notify"
 )
 
-func (in *Instance) blackjack(msg discord.Message) {
+// defaultBlackjackResponses are the responses used for actions if the game
+// does not state which response to use for them.
+var defaultBlackjackResponses = map[blackjack.Action]string{
+	blackjack.Hit:   "h",
+	blackjack.Stand: "s",
+}
 
+func (in *Instance) blackjack(msg discord.Message) {
 	if !strings.Contains(clean(msg.Embeds[0].Author.Name), in.Client.User.Username) {
 		return
 	}
-	if len(msg.Embeds[0].Fields) != 2 {
+
+	// The last field is the dealer's hand, the fields before are the player's
+	// hands. There is more than one only after splitting.
+	fields := msg.Embeds[0].Fields
+	if len(fields) < 2 {
 		return
 	}
-	var handRaw []string
-	for _, match := range exp.blackjack.FindAllStringSubmatch(msg.Embeds[0].Fields[0].Value, -1) {
-		if match[1] == "J" || match[1] == "Q" || match[1] == "K" {
-			handRaw = append(handRaw, "10")
-			continue
-		}
-		handRaw = append(handRaw, match[1])
+	dealer, err := blackjackHand(fields[len(fields)-1].Value)
+	if err != nil || len(dealer) == 0 {
+		in.Logger.Errorf("error while reading dealer's blackjack hand: %v", err)
+		return
 	}
-	handValue, handAcesAmount, handIsSoft := 0, 0, false
-	for _, card := range handRaw {
-		if card == "A" {
-			handAcesAmount++
-			continue
-		}
-		if card == "J" || card == "Q" || card == "K" {
-			handValue += 10
-			continue
-		}
-		cardValue, err := strconv.Atoi(card)
-		if err != nil {
-			in.Logger.Errorf("error while counting cards: unexpected card: %v", cardValue)
-			return
-		}
-		handValue += cardValue
-	}
-	for highAcesAmount := handAcesAmount; highAcesAmount >= 0; highAcesAmount-- {
-		if handValue+highAcesAmount*11+handAcesAmount-highAcesAmount > 21 {
-			if highAcesAmount == 0 {
-				in.Logger.Errorf("error while counting aces: hand is bust")
-				return
-			}
-			continue
-		}
-		handValue += handAcesAmount - highAcesAmount
-		handValue += highAcesAmount * 11
-		handIsSoft = highAcesAmount != 0
-		break
+	hand, err := activeBlackjackHand(fields[:len(fields)-1])
+	if err != nil {
+		in.Logger.Errorf("error while reading blackjack hand: %v", err)
+		return
 	}
-
-	hand := strconv.Itoa(handValue)
-	if handIsSoft {
-		hand = "soft" + hand
+	if hand == nil {
+		return
 	}
 
-	dealersUpCard := exp.blackjack.FindStringSubmatch(msg.Embeds[0].Fields[1].Value)[1]
-	if dealersUpCard == "J" || dealersUpCard == "Q" || dealersUpCard == "K" {
-		dealersUpCard = "10"
-	}
+	responses := blackjackResponses(msg.Content)
+	_, canDouble := responses[blackjack.Double]
+	_, canSplit := responses[blackjack.Split]
+	opts := blackjack.Options{Double: canDouble, Split: canSplit}
+	action := in.bjTable.Decide(hand, dealer[0], opts)
 
-	in.Logger.Infof("calculated blackjack hand as: %v against dealer's %v", hand, dealersUpCard)
+	in.Logger.Infof(
+		"calculated blackjack hand as: %v against dealer's %v, responding with %v",
+		hand.Key(opts.Split),
+		dealer[0].Key(),
+		action,
+	)
 
 	in.sdlr.ResumeWithCommandOrPrioritySchedule(&scheduler.Command{
-		Value:       in.Features.AutoBlackjack.LogicTable[dealersUpCard][hand],
+		Value:       responses[action],
 		Log:         "responding to blackjack",
 		AwaitResume: true,
 	})
 }
 
+// activeBlackjackHand returns the hand that is being played from the fields of
+// the player's hands. The game does not state which hand is being played after
+// splitting, so the first hand that has not reached 21 is used. It returns nil
+// if no hand is being played.
+func activeBlackjackHand(fields []discord.EmbedField) (blackjack.Hand, error) {
+	for _, field := range fields {
+		hand, err := playableBlackjackHand(field.Value)
+		if err != nil || hand != nil {
+			return hand, err
+		}
+	}
+	return nil, nil
+}
+
+// playableBlackjackHand reads the hand in s, or returns nil if it has already
+// reached 21 or busted.
+func playableBlackjackHand(s string) (blackjack.Hand, error) {
+	hand, err := blackjackHand(s)
+	if err != nil {
+		return nil, err
+	}
+	if total, _ := hand.Total(); total >= 21 || len(hand) == 0 {
+		return nil, nil
+	}
+	return hand, nil
+}
+
+// blackjackHand reads all cards in s.
+func blackjackHand(s string) (blackjack.Hand, error) {
+	var hand blackjack.Hand
+	for _, match := range exp.blackjack.FindAllStringSubmatch(s, -1) {
+		card, err := blackjack.ParseCard(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected card: %v", err)
+		}
+		hand = append(hand, card)
+	}
+	return hand, nil
+}
+
+// blackjackResponses returns the responses for every action offered in the
+// content of a blackjack message.
+func blackjackResponses(content string) map[blackjack.Action]string {
+	res := map[blackjack.Action]string{}
+	for a, r := range defaultBlackjackResponses {
+		res[a] = r
+	}
+	for _, match := range exp.blackjackOpts.FindAllStringSubmatch(content, -1) {
+		name := strings.ToLower(match[2])
+		switch {
+		case strings.Contains(name, "hit"):
+			res[blackjack.Hit] = match[1]
+		case strings.Contains(name, "stand"):
+			res[blackjack.Stand] = match[1]
+		case strings.Contains(name, "double"):
+			res[blackjack.Double] = match[1]
+		case strings.Contains(name, "split"):
+			res[blackjack.Split] = match[1]
+		}
+	}
+	return res
+}
+
+// isBlackjackTrigger returns true if the scheduler is awaiting a resume because
+// of a blackjack command or a response to a blackjack game.
+func isBlackjackTrigger(trigger *scheduler.Command) bool {
+	if strings.HasPrefix(trigger.Value, blackjackBaseCmdValue) {
+		return true
+	}
+	return exp.blackjackResponse.MatchString(trigger.Value)
+}
+
 func (in *Instance) blackjackEnd(msg discord.Message) {
-	if strings.Contains(msg.Content, "Type `h` to **hit**, type `s` to **stand**, or type `e` to **end** the game.") {
+	if exp.blackjackPrompt.MatchString(msg.Content) {
 		return
 	}
 	if !strings.Contains(clean(msg.Embeds[0].Author.Name), in.Client.User.Username) {
@@ -94,18 +154,10 @@ func (in *Instance) blackjackEnd(msg discord.Message) {
 	if !exp.blackjackBal.MatchString(msg.Embeds[0].Description) {
 		return
 	}
-	trigger := in.sdlr.AwaitResumeTrigger()
-	if trigger != nil {
-	rowLoop:
-		for _, row := range in.Features.AutoBlackjack.LogicTable {
-			for _, val := range row {
-				if val == trigger.Value {
-					in.sdlr.Resume()
-					break rowLoop
-				}
-			}
-		}
+	if trigger := in.sdlr.AwaitResumeTrigger(); trigger != nil && isBlackjackTrigger(trigger) {
+		in.sdlr.Resume()
 	}
+	in.blackjackResult(msg.Embeds[0].Description)
 	balstr := strings.Replace(exp.blackjackBal.FindStringSubmatch(msg.Embeds[0].Description)[5], ",", "", -1)
 	balance, err := strconv.Atoi(balstr)
 	if err != nil {
@@ -113,4 +165,8 @@ func (in *Instance) blackjackEnd(msg discord.Message) {
 		return
 	}
 	in.updateBalance(balance)
+	if in.blackjackBroke() {
+		in.Logger.Warnf("not enough coins left to play blackjack")
+		in.notify(notify.EventBlackjackBroke, "not enough coins left to play blackjack, balance is %v", numFmt.Sprintf("%d", balance))
+	}
 }
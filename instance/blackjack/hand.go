@@ -0,0 +1,106 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+// Package blackjack models blackjack cards and hands and decides what to do
+// with a hand based on a strategy table.
+package blackjack
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Card is the rank of a card as it is displayed, for example "7", "K" or "A".
+// Suits are irrelevant in blackjack and are therefore not modelled.
+type Card string
+
+// ParseCard returns the card with rank r. An error is returned if r is not a
+// valid rank.
+func ParseCard(r string) (Card, error) {
+	switch r {
+	case "J", "Q", "K", "A":
+		return Card(r), nil
+	}
+	n, err := strconv.Atoi(r)
+	if err != nil || n < 2 || n > 10 {
+		return "", fmt.Errorf("invalid card rank: %v", r)
+	}
+	return Card(r), nil
+}
+
+// Value returns the value of the card. Aces are counted as 1, see Hand.Total
+// for the value of a hand with aces.
+func (c Card) Value() int {
+	switch c {
+	case "J", "Q", "K":
+		return 10
+	case "A":
+		return 1
+	}
+	n, _ := strconv.Atoi(string(c))
+	return n
+}
+
+// Key returns the key used for the card in a strategy table, which is the same
+// for all cards with a value of 10.
+func (c Card) Key() string {
+	if c == "A" {
+		return "A"
+	}
+	return strconv.Itoa(c.Value())
+}
+
+// Hand is a blackjack hand, in the order the cards were dealt.
+type Hand []Card
+
+// Total returns the value of the hand and whether it is soft. A hand is soft if
+// it contains an ace that is counted as 11.
+func (h Hand) Total() (total int, soft bool) {
+	var aces int
+	for _, c := range h {
+		if c == "A" {
+			aces++
+		}
+		total += c.Value()
+	}
+
+	// At most a single ace can count as 11, two would already be 22.
+	if aces > 0 && total+10 <= 21 {
+		return total + 10, true
+	}
+	return total, false
+}
+
+// IsBust returns true if the value of the hand is more than 21.
+func (h Hand) IsBust() bool {
+	total, _ := h.Total()
+	return total > 21
+}
+
+// IsBlackjack returns true if the hand is a natural blackjack: an ace and a
+// card with a value of 10 as the first two cards.
+func (h Hand) IsBlackjack() bool {
+	total, _ := h.Total()
+	return len(h) == 2 && total == 21
+}
+
+// IsPair returns true if the hand consists of two cards with the same value.
+func (h Hand) IsPair() bool {
+	return len(h) == 2 && h[0].Key() == h[1].Key()
+}
+
+// Key returns the row key of the hand in a strategy table, for example "16",
+// "soft18" or "pair8". A pair is only keyed as such if pair is true.
+func (h Hand) Key(pair bool) string {
+	if pair && h.IsPair() {
+		return "pair" + h[0].Key()
+	}
+	total, soft := h.Total()
+	if soft {
+		return "soft" + strconv.Itoa(total)
+	}
+	return strconv.Itoa(total)
+}
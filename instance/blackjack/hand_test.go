@@ -0,0 +1,88 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package blackjack
+
+import "testing"
+
+func hand(cards ...Card) Hand {
+	return Hand(cards)
+}
+
+func TestHandTotal(t *testing.T) {
+	tests := []struct {
+		hand  Hand
+		total int
+		soft  bool
+	}{
+		{hand("2", "3"), 5, false},
+		{hand("K", "Q"), 20, false},
+		{hand("A", "6"), 17, true},
+		{hand("A", "6", "10"), 17, false},
+		{hand("A", "A"), 12, true},
+		{hand("A", "A", "9"), 21, true},
+		{hand("A", "A", "A", "A", "7"), 21, true},
+		{hand("A", "A", "K"), 12, false},
+		{hand("A", "K"), 21, true},
+		{hand("10", "6", "A"), 17, false},
+		{hand("10", "6", "9"), 25, false},
+	}
+	for _, test := range tests {
+		total, soft := test.hand.Total()
+		if total != test.total || soft != test.soft {
+			t.Errorf("%v: got total %v, soft %v, want total %v, soft %v", test.hand, total, soft, test.total, test.soft)
+		}
+	}
+}
+
+func TestHandKey(t *testing.T) {
+	tests := []struct {
+		hand Hand
+		pair bool
+		key  string
+	}{
+		{hand("8", "8"), true, "pair8"},
+		{hand("8", "8"), false, "16"},
+		{hand("K", "10"), true, "pair10"},
+		{hand("A", "A"), true, "pairA"},
+		{hand("A", "A"), false, "soft12"},
+		{hand("A", "7"), true, "soft18"},
+		{hand("8", "8", "2"), true, "18"},
+	}
+	for _, test := range tests {
+		if key := test.hand.Key(test.pair); key != test.key {
+			t.Errorf("%v, pair %v: got %v, want %v", test.hand, test.pair, key, test.key)
+		}
+	}
+}
+
+func TestHandBlackjackAndBust(t *testing.T) {
+	if !hand("A", "K").IsBlackjack() {
+		t.Errorf("A K: not a blackjack")
+	}
+	if hand("7", "7", "7").IsBlackjack() {
+		t.Errorf("7 7 7: blackjack with more than two cards")
+	}
+	if !hand("10", "6", "9").IsBust() {
+		t.Errorf("10 6 9: not bust")
+	}
+	if hand("A", "A", "K").IsBust() {
+		t.Errorf("A A K: bust")
+	}
+}
+
+func TestParseCard(t *testing.T) {
+	for _, r := range []string{"2", "10", "J", "Q", "K", "A"} {
+		if _, err := ParseCard(r); err != nil {
+			t.Errorf("%v: unexpected error: %v", r, err)
+		}
+	}
+	for _, r := range []string{"1", "11", "B", ""} {
+		if _, err := ParseCard(r); err == nil {
+			t.Errorf("%v: expected error", r)
+		}
+	}
+}
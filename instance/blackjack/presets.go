@@ -0,0 +1,126 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package blackjack
+
+import (
+	"strconv"
+	"strings"
+)
+
+// dealerKeys are the column keys of a strategy table, in the order they are
+// used by the rows passed to newTable.
+var dealerKeys = []string{"2", "3", "4", "5", "6", "7", "8", "9", "10", "A"}
+
+var presets = map[string]Table{
+	// Basic strategy for multiple decks where the dealer stands on soft 17 and
+	// doubling down after splitting is allowed.
+	"basic": newTable(map[string]string{
+		"4-8":    "h h h h h h h h h h",
+		"9":      "h d d d d h h h h h",
+		"10":     "d d d d d d d d h h",
+		"11":     "d d d d d d d d d h",
+		"12":     "h h s s s h h h h h",
+		"13-16":  "s s s s s h h h h h",
+		"17-20":  "s s s s s s s s s s",
+		"soft12": "h h h h h h h h h h",
+		"soft13": "h h h d d h h h h h",
+		"soft14": "h h h d d h h h h h",
+		"soft15": "h h d d d h h h h h",
+		"soft16": "h h d d d h h h h h",
+		"soft17": "h d d d d h h h h h",
+		"soft18": "s ds ds ds ds s s h h h",
+		"soft19": "s s s s s s s s s s",
+		"soft20": "s s s s s s s s s s",
+		"pair2":  "p p p p p p h h h h",
+		"pair3":  "p p p p p p h h h h",
+		"pair4":  "h h h p p h h h h h",
+		"pair5":  "d d d d d d d d h h",
+		"pair6":  "p p p p p h h h h h",
+		"pair7":  "p p p p p p h h h h",
+		"pair8":  "p p p p p p p p p p",
+		"pair9":  "p p p p p s p p s s",
+		"pair10": "s s s s s s s s s s",
+		"pairA":  "p p p p p p p p p p",
+	}),
+
+	// Basic strategy for multiple decks where the dealer hits on soft 17 and
+	// doubling down after splitting is allowed.
+	"basic_h17": newTable(map[string]string{
+		"4-8":    "h h h h h h h h h h",
+		"9":      "h d d d d h h h h h",
+		"10":     "d d d d d d d d h h",
+		"11":     "d d d d d d d d d d",
+		"12":     "h h s s s h h h h h",
+		"13-16":  "s s s s s h h h h h",
+		"17-20":  "s s s s s s s s s s",
+		"soft12": "h h h h h h h h h h",
+		"soft13": "h h h d d h h h h h",
+		"soft14": "h h h d d h h h h h",
+		"soft15": "h h d d d h h h h h",
+		"soft16": "h h d d d h h h h h",
+		"soft17": "h d d d d h h h h h",
+		"soft18": "ds ds ds ds ds s s h h h",
+		"soft19": "s s s s ds s s s s s",
+		"soft20": "s s s s s s s s s s",
+		"pair2":  "p p p p p p h h h h",
+		"pair3":  "p p p p p p h h h h",
+		"pair4":  "h h h p p h h h h h",
+		"pair5":  "d d d d d d d d h h",
+		"pair6":  "p p p p p h h h h h",
+		"pair7":  "p p p p p p h h h h",
+		"pair8":  "p p p p p p p p p p",
+		"pair9":  "p p p p p s p p s s",
+		"pair10": "s s s s s s s s s s",
+		"pairA":  "p p p p p p p p p p",
+	}),
+
+	// The logic table that was shipped in the default config before presets
+	// were available. It only hits and stands.
+	"legacy": newTable(map[string]string{
+		"4-13":      "h h h h h h h h h h",
+		"14":        "h h s s s h h h h h",
+		"15-16":     "s s s s s h h h h h",
+		"17":        "s s s s s s s s s h",
+		"18-20":     "s s s s s s s s s s",
+		"soft12-16": "h h h h h h h h h h",
+		"soft17":    "s s s s s s h h h h",
+		"soft18-20": "s s s s s s s s s s",
+	}),
+}
+
+// newTable builds a Table from rows of space separated actions, one for every
+// dealer up card in dealerKeys. A row key may be a range such as "13-16" or
+// "soft18-20" to use the same row for every hand in it.
+func newTable(rows map[string]string) Table {
+	t := Table{}
+	for _, col := range dealerKeys {
+		t[col] = map[string]Action{}
+	}
+	for k, row := range rows {
+		for _, key := range expandKey(k) {
+			for i, a := range strings.Fields(row) {
+				t[dealerKeys[i]][key] = Action(a)
+			}
+		}
+	}
+	return t
+}
+
+func expandKey(k string) []string {
+	bounds := strings.SplitN(k, "-", 2)
+	if len(bounds) != 2 {
+		return []string{k}
+	}
+	prefix := strings.TrimRight(bounds[0], "0123456789")
+	from, _ := strconv.Atoi(strings.TrimPrefix(bounds[0], prefix))
+	to, _ := strconv.Atoi(bounds[1])
+	var keys []string
+	for n := from; n <= to; n++ {
+		keys = append(keys, prefix+strconv.Itoa(n))
+	}
+	return keys
+}
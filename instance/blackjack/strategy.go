@@ -0,0 +1,196 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package blackjack
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Action is a decision that can be made for a hand. The values are the ones
+// used in logic tables in the config.
+type Action string
+
+const (
+	Hit    Action = "h"
+	Stand  Action = "s"
+	Double Action = "d"
+
+	// DoubleOrStand doubles down if the game allows it and stands otherwise.
+	// Double on its own hits if doubling down is not allowed.
+	DoubleOrStand Action = "ds"
+	Split         Action = "p"
+)
+
+// Options holds the actions the game offers besides hitting and standing.
+type Options struct {
+	Double bool
+	Split  bool
+}
+
+// Table is a strategy table. The first key is the dealer's up card as returned
+// by Card.Key, the second key is the player's hand as returned by Hand.Key.
+type Table map[string]map[string]Action
+
+// Decide returns the action to take for hand against the dealer's up card. The
+// returned action is always one that is available according to opts, so it is
+// never DoubleOrStand. Entries missing from the table default to hitting below
+// 17 and standing otherwise.
+func (t Table) Decide(hand Hand, up Card, opts Options) Action {
+	row := t[up.Key()]
+	total, _ := hand.Total()
+	if total >= 21 {
+		return Stand
+	}
+	if opts.Split && hand.IsPair() {
+		if a, ok := row[hand.Key(true)]; ok {
+			if a == Split {
+				return Split
+			}
+			return available(a, opts)
+		}
+	}
+	if a, ok := row[hand.Key(false)]; ok && a != Split {
+		return available(a, opts)
+	}
+	if total >= 17 {
+		return Stand
+	}
+	return Hit
+}
+
+// available replaces a with the action to fall back to if a is not offered.
+func available(a Action, opts Options) Action {
+	switch a {
+	case Double:
+		if opts.Double {
+			return Double
+		}
+		return Hit
+	case DoubleOrStand:
+		if opts.Double {
+			return Double
+		}
+		return Stand
+	}
+	return a
+}
+
+// Merge returns a copy of t with every entry of other added to it, replacing
+// entries of t which already exist.
+func (t Table) Merge(other Table) Table {
+	res := Table{}
+	for _, tbl := range []Table{t, other} {
+		for col, row := range tbl {
+			if res[col] == nil {
+				res[col] = map[string]Action{}
+			}
+			for k, a := range row {
+				res[col][k] = a
+			}
+		}
+	}
+	return res
+}
+
+// ParseTable converts a logic table as found in the config to a Table. An
+// error is returned if any of its keys or values are invalid.
+func ParseTable(raw map[string]map[string]string) (Table, error) {
+	t := Table{}
+	for col, row := range raw {
+		if col != "A" {
+			n, err := strconv.Atoi(col)
+			if err != nil || n < 2 || n > 10 {
+				return nil, fmt.Errorf("invalid dealer card key: %v", col)
+			}
+		}
+		t[col] = map[string]Action{}
+		for k, v := range row {
+			if err := validateRowKey(k); err != nil {
+				return nil, err
+			}
+			a := Action(v)
+			switch a {
+			case Hit, Stand, Double, DoubleOrStand:
+			case Split:
+				if !strings.HasPrefix(k, "pair") {
+					return nil, fmt.Errorf("invalid action for %v: only pairs can be split", k)
+				}
+			default:
+				return nil, fmt.Errorf("invalid action for %v: %v", k, v)
+			}
+			t[col][k] = a
+		}
+	}
+	return t, nil
+}
+
+func validateRowKey(k string) error {
+	if strings.HasPrefix(k, "pair") {
+		r := strings.TrimPrefix(k, "pair")
+		if c, err := ParseCard(r); err != nil || c.Key() != r {
+			return fmt.Errorf("invalid pair key: %v", k)
+		}
+		return nil
+	}
+	min := 4
+	if strings.HasPrefix(k, "soft") {
+		k, min = strings.TrimPrefix(k, "soft"), 12
+	}
+	n, err := strconv.Atoi(k)
+	if err != nil || n < min || n > 20 {
+		return fmt.Errorf("invalid hand key: %v", k)
+	}
+	return nil
+}
+
+// DefaultPreset is the name of the preset used when neither a preset nor a
+// custom logic table is configured.
+const DefaultPreset = "basic"
+
+// NewTable returns the preset with the passed name, with the entries of the
+// custom logic table added to it. If name is empty, only the custom logic table
+// is used, or DefaultPreset if the custom logic table is empty as well.
+func NewTable(name string, custom map[string]map[string]string) (Table, error) {
+	t, err := ParseTable(custom)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		if len(t) > 0 {
+			return t, nil
+		}
+		name = DefaultPreset
+	}
+	preset, ok := Preset(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown preset: %v, available presets are %v", name, strings.Join(Presets(), ", "))
+	}
+	return preset.Merge(t), nil
+}
+
+// Preset returns the built-in strategy table with the passed name. The second
+// return value is false if no such table exists.
+func Preset(name string) (Table, bool) {
+	t, ok := presets[name]
+	if !ok {
+		return nil, false
+	}
+	return t.Merge(nil), true
+}
+
+// Presets returns the names of all built-in strategy tables.
+func Presets() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
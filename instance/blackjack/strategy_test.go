@@ -0,0 +1,200 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package blackjack
+
+import "testing"
+
+var all = Options{Double: true, Split: true}
+
+type decision struct {
+	hand Hand
+	up   Card
+	opts Options
+	want Action
+}
+
+func testDecisions(t *testing.T, preset string, tests []decision) {
+	tbl, ok := Preset(preset)
+	if !ok {
+		t.Fatalf("preset %v not found", preset)
+	}
+	for _, test := range tests {
+		if got := tbl.Decide(test.hand, test.up, test.opts); got != test.want {
+			t.Errorf(
+				"%v: %v against %v with %+v: got %v, want %v",
+				preset,
+				test.hand,
+				test.up,
+				test.opts,
+				got,
+				test.want,
+			)
+		}
+	}
+}
+
+// The expected decisions are taken from the published basic strategy charts
+// for multiple decks with doubling down after splitting.
+func TestDecideBasic(t *testing.T) {
+	testDecisions(t, "basic", []decision{
+		{hand("5", "3"), "6", all, Hit},
+		{hand("5", "4"), "3", all, Double},
+		{hand("5", "4"), "3", Options{}, Hit},
+		{hand("5", "4"), "7", all, Hit},
+		{hand("6", "4"), "9", all, Double},
+		{hand("6", "4"), "K", all, Hit},
+		{hand("6", "5"), "10", all, Double},
+		{hand("6", "5"), "A", all, Hit},
+		{hand("10", "2"), "2", all, Hit},
+		{hand("10", "2"), "4", all, Stand},
+		{hand("10", "2"), "7", all, Hit},
+		{hand("10", "6"), "6", all, Stand},
+		{hand("10", "6"), "10", all, Hit},
+		{hand("10", "7"), "A", all, Stand},
+		{hand("A", "2"), "5", all, Double},
+		{hand("A", "2"), "4", all, Hit},
+		{hand("A", "6"), "3", all, Double},
+		{hand("A", "6"), "7", all, Hit},
+		{hand("A", "7"), "2", all, Stand},
+		{hand("A", "7"), "6", all, Double},
+		{hand("A", "7"), "6", Options{}, Stand},
+		{hand("A", "7"), "9", all, Hit},
+		{hand("A", "8"), "6", all, Stand},
+		{hand("2", "2"), "7", all, Split},
+		{hand("2", "2"), "8", all, Hit},
+		{hand("4", "4"), "5", all, Split},
+		{hand("4", "4"), "5", Options{Double: true}, Hit},
+		{hand("5", "5"), "9", all, Double},
+		{hand("8", "8"), "A", all, Split},
+		{hand("8", "8"), "10", Options{Double: true}, Hit},
+		{hand("9", "9"), "7", all, Stand},
+		{hand("9", "9"), "8", all, Split},
+		{hand("K", "Q"), "6", all, Stand},
+		{hand("A", "A"), "A", all, Split},
+		{hand("A", "A"), "A", Options{}, Hit},
+		{hand("A", "K"), "10", all, Stand},
+		{hand("7", "7", "7"), "A", all, Stand},
+	})
+}
+
+func TestDecideBasicH17(t *testing.T) {
+	testDecisions(t, "basic_h17", []decision{
+		{hand("6", "5"), "A", all, Double},
+		{hand("A", "7"), "2", all, Double},
+		{hand("A", "7"), "2", Options{}, Stand},
+		{hand("A", "8"), "6", all, Double},
+		{hand("A", "8"), "5", all, Stand},
+		{hand("10", "6"), "10", all, Hit},
+		{hand("8", "8"), "A", all, Split},
+	})
+}
+
+func TestDecideLegacy(t *testing.T) {
+	testDecisions(t, "legacy", []decision{
+		{hand("10", "3"), "4", all, Hit},
+		{hand("10", "4"), "2", all, Hit},
+		{hand("10", "4"), "4", all, Stand},
+		{hand("10", "6"), "6", all, Stand},
+		{hand("10", "6"), "7", all, Hit},
+		{hand("10", "7"), "A", all, Hit},
+		{hand("10", "8"), "A", all, Stand},
+		{hand("A", "6"), "7", all, Stand},
+		{hand("A", "6"), "8", all, Hit},
+
+		// The legacy table has no pairs and never doubles down.
+		{hand("8", "8"), "10", all, Hit},
+		{hand("5", "6"), "6", all, Hit},
+	})
+}
+
+func TestPresets(t *testing.T) {
+	for _, name := range Presets() {
+		tbl, _ := Preset(name)
+		for _, col := range dealerKeys {
+			if len(tbl[col]) == 0 {
+				t.Errorf("%v: no decisions against %v", name, col)
+			}
+		}
+	}
+	if _, ok := Preset("unknown"); ok {
+		t.Errorf("unknown preset found")
+	}
+}
+
+func TestParseTable(t *testing.T) {
+	valid := map[string]map[string]string{
+		"10": {"16": "s", "soft18": "ds", "pair8": "p"},
+		"A":  {"11": "d"},
+	}
+	tbl, err := ParseTable(valid)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tbl["10"]["16"] != Stand || tbl["10"]["pair8"] != Split || tbl["A"]["11"] != Double {
+		t.Errorf("unexpected table: %v", tbl)
+	}
+
+	invalid := []map[string]map[string]string{
+		{"11": {"16": "s"}},
+		{"1": {"16": "s"}},
+		{"J": {"16": "s"}},
+		{"10": {"16": "x"}},
+		{"10": {"16": "p"}},
+		{"10": {"21": "s"}},
+		{"10": {"3": "h"}},
+		{"10": {"soft11": "h"}},
+		{"10": {"pairJ": "p"}},
+		{"10": {"pair1": "p"}},
+	}
+	for _, raw := range invalid {
+		if _, err := ParseTable(raw); err == nil {
+			t.Errorf("%v: expected error", raw)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	basic, _ := Preset("basic")
+	custom, err := ParseTable(map[string]map[string]string{
+		"10": {"16": "s"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	merged := basic.Merge(custom)
+	if got := merged.Decide(hand("10", "6"), "10", all); got != Stand {
+		t.Errorf("merged 16 against 10: got %v, want %v", got, Stand)
+	}
+	if got := merged.Decide(hand("10", "6"), "9", all); got != Hit {
+		t.Errorf("merged 16 against 9: got %v, want %v", got, Hit)
+	}
+	if got := basic.Decide(hand("10", "6"), "10", all); got != Hit {
+		t.Errorf("merge modified the preset: got %v, want %v", got, Hit)
+	}
+}
+
+func TestNewTable(t *testing.T) {
+	custom := map[string]map[string]string{"10": {"16": "s"}}
+	tbl, err := NewTable("", custom)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Without a preset, a custom table is used on its own.
+	if len(tbl) != 1 {
+		t.Errorf("custom table merged with a preset: %v", tbl)
+	}
+	tbl, err = NewTable("", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := tbl.Decide(hand("6", "5"), "10", all); got != Double {
+		t.Errorf("default preset 11 against 10: got %v, want %v", got, Double)
+	}
+	if _, err = NewTable("unknown", nil); err == nil {
+		t.Errorf("unknown preset: expected error")
+	}
+}
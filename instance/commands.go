@@ -8,7 +8,6 @@ package instance
 
 import (
 	"fmt"
-	"strconv"
 	"time"
 
 	"github.com/dankgrinder/dankgrinder/instance/scheduler"
@@ -22,6 +21,7 @@ const (
 	fishCmdValue          = "pls fish"
 	huntCmdValue          = "pls hunt"
 	balanceCheckCmdValue  = "pls bal"
+	inventoryBaseCmdValue = "pls inv"
 	tidepodCmdValue       = "pls use tidepod"
 	acceptTidepodCmdValue = "y"
 	buyBaseCmdValue       = "pls buy"
@@ -30,16 +30,39 @@ const (
 	shopBaseCmdValue      = "pls shop"
 	giftBaseCmdValue      = "pls gift"
 	shareBaseCmdValue     = "pls share"
+	depositBaseCmdValue   = "pls dep"
+	withdrawBaseCmdValue  = "pls with"
+	useBaseCmdValue       = "pls use"
 )
 
 func blackjackCmdValue(amount string) string {
 	return fmt.Sprintf("%v %v", blackjackBaseCmdValue, amount)
 }
 
+func inventoryCmdValue(page string) string {
+	return fmt.Sprintf("%v %v", inventoryBaseCmdValue, page)
+}
+
 func buyCmdValue(amount, item string) string {
 	return fmt.Sprintf("%v %v %v", buyBaseCmdValue, item, amount)
 }
 
+func rewardCmdValue(name string) string {
+	return fmt.Sprintf("pls %v", name)
+}
+
+func useCmdValue(item string) string {
+	return fmt.Sprintf("%v %v", useBaseCmdValue, item)
+}
+
+func depositCmdValue(amount string) string {
+	return fmt.Sprintf("%v %v", depositBaseCmdValue, amount)
+}
+
+func withdrawCmdValue(amount string) string {
+	return fmt.Sprintf("%v %v", withdrawBaseCmdValue, amount)
+}
+
 func sellCmdValue(amount, item string) string {
 	return fmt.Sprintf("%v %v %v", sellBaseCmdValue, item, amount)
 }
@@ -107,6 +130,13 @@ func (in *Instance) newCmds() []*scheduler.Command {
 			Interval: time.Duration(in.Features.BalanceCheck.Interval) * time.Second,
 		})
 	}
+	if in.Features.InventoryCheck.Enable {
+		cmds = append(cmds, &scheduler.Command{
+			Value:       inventoryBaseCmdValue,
+			Interval:    time.Duration(in.Features.InventoryCheck.Interval) * time.Second,
+			AwaitResume: true,
+		})
+	}
 	if in.Features.AutoTidepod.Enable {
 		cmds = append(cmds, &scheduler.Command{
 			Value:       tidepodCmdValue,
@@ -117,19 +147,28 @@ func (in *Instance) newCmds() []*scheduler.Command {
 	if in.Features.AutoBlackjack.Enable {
 		cmds = append(cmds, in.newAutoBlackjackCmd())
 	}
+	if in.Features.AutoUse.Enable {
+		cmds = append(cmds, in.newAutoUseCmds()...)
+	}
 
 	for _, cmd := range in.Features.CustomCommands {
 		// cmd.Value and cmd.Amount are not checked for correct values here
 		// because they were checked when the application started using
 		// cfg.Validate().
-		cmds = append(cmds, &scheduler.Command{
+		pauseBelow := cmd.PauseBelowBalance
+		custom := &scheduler.Command{
 			Value:    cmd.Value,
 			Interval: time.Duration(cmd.Interval) * time.Second,
 			Amount:   uint(cmd.Amount),
 			CondFunc: func() bool {
-				return cmd.PauseBelowBalance == 0 || in.balance >= cmd.PauseBelowBalance
+				return pauseBelow == 0 || in.balance >= pauseBelow
 			},
-		})
+		}
+		in.trackExecs(custom)
+		if custom.Amount != 0 && custom.Execs() >= custom.Amount {
+			continue
+		}
+		cmds = append(cmds, custom)
 	}
 	return cmds
 }
@@ -150,7 +189,13 @@ func (in *Instance) newAutoSellChain() *scheduler.Command {
 
 func (in *Instance) newAutoGiftChain() *scheduler.Command {
 	var cmds []*scheduler.Command
-	for _, item := range in.Features.AutoGift.Items {
+	seen := map[string]bool{}
+	for _, route := range in.Features.GiftRoutes() {
+		item := route.Item
+		if seen[itemKey(item)] {
+			continue
+		}
+		seen[itemKey(item)] = true
 		cmds = append(cmds, &scheduler.Command{
 			Value:       shopCmdValue(item),
 			Interval:    time.Duration(in.Compat.Cooldown.Gift) * time.Second,
@@ -164,20 +209,23 @@ func (in *Instance) newAutoGiftChain() *scheduler.Command {
 }
 
 func (in *Instance) newAutoBlackjackCmd() *scheduler.Command {
-	cmd := &scheduler.Command{
-		Value:    blackjackCmdValue(strconv.Itoa(in.Features.AutoBlackjack.Amount)),
+	return &scheduler.Command{
+		Value:    blackjackCmdValue(in.blackjackBet()),
 		Interval: time.Duration(in.Compat.Cooldown.Blackjack) * time.Second,
 		CondFunc: func() bool {
-			correctBalance := in.Features.AutoBlackjack.PauseBelowBalance == 0 || in.balance >= in.Features.AutoBlackjack.PauseBelowBalance
-			return correctBalance && in.balance < 10000000
+			ab := in.Features.AutoBlackjack
+			correctBalance := (ab.PauseBelowBalance == 0 || in.balance >= ab.PauseBelowBalance) &&
+				(ab.MaximumBalance == 0 || in.balance < ab.MaximumBalance)
+			return correctBalance && !in.blackjackSessionOver() && in.blackjackBet() != ""
+		},
+		ValueFunc: func() string {
+			bet := in.blackjackBet()
+			in.bankroll.placeBet(bet)
+			return blackjackCmdValue(bet)
 		},
 		AwaitResume:          true,
 		RescheduleAsPriority: in.Features.AutoBlackjack.Priority,
 	}
-	if in.Features.AutoBlackjack.Amount == 0 {
-		cmd.Value = blackjackCmdValue("max")
-	}
-	return cmd
 }
 
 func (in *Instance) newCmdChain(cmds []*scheduler.Command, chainInterval time.Duration) *scheduler.Command {
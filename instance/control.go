@@ -0,0 +1,155 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/config"
+	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+)
+
+// shiftOverride is a shift forced through ForceShift.
+type shiftOverride struct {
+	state string
+	dur   time.Duration
+}
+
+// Status is a snapshot of the state of an instance.
+type Status struct {
+	ID       string    `json:"id"`
+	Username string    `json:"username"`
+	Name     string    `json:"name,omitempty"`
+	Cluster  string    `json:"cluster"`
+	Master   bool      `json:"master"`
+	State    string    `json:"state"`
+	ShiftEnd time.Time `json:"shift_end,omitempty"`
+	Paused   bool      `json:"paused"`
+	Closed   bool      `json:"closed"`
+	Balance  int       `json:"balance"`
+	Bank     int       `json:"bank"`
+	NetWorth int       `json:"net_worth"`
+	Queued   int       `json:"queued"`
+
+	// HourlyIncome is the average net income per hour since the instance
+	// started, see HourlyIncome.
+	HourlyIncome int `json:"hourly_income"`
+
+	// Postmeme is the observed outcome of every meme type, if postmeme is
+	// enabled.
+	Postmeme []ChoiceStatus `json:"postmeme,omitempty"`
+}
+
+// Status returns a snapshot of the state of the instance.
+func (in *Instance) Status() Status {
+	m := in.Metrics()
+	var postmeme []ChoiceStatus
+	if in.Features.Commands.Postmeme && in.postmemeStats != nil {
+		postmeme = in.postmemeStats.status()
+	}
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	return Status{
+		ID:       in.Client.User.ID,
+		Username: in.Client.User.Username,
+		Name:     in.Name,
+		Cluster:  in.ClusterName,
+		Master:   in == in.Master,
+		State:    m.ShiftState,
+		ShiftEnd: in.shiftEnd,
+		Paused:   in.paused,
+		Closed:   in.isClosed,
+		Balance:  m.Balance,
+		Bank:     m.Bank,
+		NetWorth: m.NetWorth,
+		Queued:   m.QueueDepth,
+
+		HourlyIncome: in.HourlyIncome(),
+		Postmeme:     postmeme,
+	}
+}
+
+// Pause stops the instance from sending commands until Resume is called. It
+// stays paused across shifts.
+func (in *Instance) Pause() {
+	in.mu.Lock()
+	in.paused = true
+	if in.sdlr != nil {
+		in.sdlr.Pause()
+	}
+	in.mu.Unlock()
+	in.Logger.Infof("paused")
+}
+
+// Resume makes a paused instance send commands again.
+func (in *Instance) Resume() {
+	in.mu.Lock()
+	in.paused = false
+	if in.sdlr != nil {
+		in.sdlr.Unpause()
+	}
+	in.mu.Unlock()
+	in.Logger.Infof("resumed")
+}
+
+// ForceShift switches the instance to state for dur, replacing the remainder of
+// the current shift. After dur, the instance continues with the next shift.
+func (in *Instance) ForceShift(state string, dur time.Duration) error {
+	if state != config.ShiftStateActive && state != config.ShiftStateDormant {
+		return fmt.Errorf("invalid shift state: %v", state)
+	}
+	if dur <= 0 {
+		return fmt.Errorf("shift duration must be greater than 0")
+	}
+	if in.IsClosed() || in.override == nil {
+		return fmt.Errorf("instance is not running")
+	}
+	select {
+	case in.override <- shiftOverride{state: state, dur: dur}:
+		return nil
+	default:
+		return fmt.Errorf("another forced shift is being started")
+	}
+}
+
+// Queued returns the values of the commands waiting to be sent, in order.
+func (in *Instance) Queued() []string {
+	sdlr := in.activeSdlr()
+	if sdlr == nil {
+		return nil
+	}
+	return sdlr.Queued()
+}
+
+// Run sends value as a command once, before the commands that are already
+// queued.
+func (in *Instance) Run(value string) error {
+	if value == "" {
+		return fmt.Errorf("no command")
+	}
+	sdlr := in.activeSdlr()
+	if sdlr == nil {
+		return fmt.Errorf("instance is not in an active shift")
+	}
+	sdlr.PrioritySchedule(&scheduler.Command{
+		Value: value,
+		Log:   "sending one-off command",
+	})
+	return nil
+}
+
+// activeSdlr returns the scheduler if the instance is in an active shift, and
+// nil otherwise.
+func (in *Instance) activeSdlr() *scheduler.Scheduler {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	if in.lastState != config.ShiftStateActive {
+		return nil
+	}
+	return in.sdlr
+}
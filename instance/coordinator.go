@@ -0,0 +1,55 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"sort"
+	"sync"
+)
+
+// Coordinator gives instances access to the instances of other clusters, so
+// coins and items can be moved between clusters.
+type Coordinator struct {
+	mu       sync.Mutex
+	clusters map[string]coordinatedCluster
+}
+
+type coordinatedCluster struct {
+	master    *Instance
+	instances []*Instance
+}
+
+// Register adds a cluster to the coordinator. instances must include master.
+func (c *Coordinator) Register(name string, master *Instance, instances []*Instance) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.clusters == nil {
+		c.clusters = map[string]coordinatedCluster{}
+	}
+	c.clusters[name] = coordinatedCluster{master: master, instances: instances}
+}
+
+// Cluster returns the master and the instances of the cluster with the passed
+// name. The third return value is false if no such cluster was registered.
+func (c *Coordinator) Cluster(name string) (*Instance, []*Instance, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cluster, ok := c.clusters[name]
+	return cluster.master, cluster.instances, ok
+}
+
+// Clusters returns the names of all registered clusters.
+func (c *Coordinator) Clusters() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for name := range c.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
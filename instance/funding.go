@@ -0,0 +1,139 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+)
+
+// fundingNeed is the amount of coins an instance needs to reach its minimum
+// auto-share balance.
+type fundingNeed struct {
+	to      *Instance
+	deficit int
+}
+
+// withTax returns the amount to share for the recipient to receive net after
+// the share tax, which is a percentage.
+func withTax(net int, tax float64) int {
+	return int(math.Ceil(float64(net) / (1 - tax/100)))
+}
+
+// planFunding returns the amount to share with every instance in needs. If the
+// available coins do not cover all needs, every instance gets the same
+// fraction of its deficit, so one large deficit does not starve the others.
+func planFunding(needs []fundingNeed, available int, tax float64) map[*Instance]int {
+	plan := map[*Instance]int{}
+	var total int
+	for _, need := range needs {
+		total += withTax(need.deficit, tax)
+	}
+	if total == 0 {
+		return plan
+	}
+	frac := 1.0
+	if total > available {
+		frac = float64(available) / float64(total)
+	}
+	for _, need := range needs {
+		if amount := int(math.Floor(float64(withTax(need.deficit, tax)) * frac)); amount > 0 {
+			plan[need.to] = amount
+		}
+	}
+	return plan
+}
+
+// isBalanceStale returns true if the balance of the instance is unknown or was
+// last updated longer than two balance check intervals ago.
+func (in *Instance) isBalanceStale() bool {
+	last := in.LastBalanceUpdate()
+	if last.IsZero() {
+		return true
+	}
+	maxAge := 2 * time.Duration(in.Features.BalanceCheck.Interval) * time.Second
+	return time.Now().Sub(last) > maxAge
+}
+
+// expectFunding marks the instance as being funded. It is not funded again
+// until its balance is checked, so it is not funded twice for the same deficit.
+// Other uses of the balance, such as share routes, are not affected.
+func (in *Instance) expectFunding() {
+	atomic.StoreInt32(&in.fundingPending, 1)
+}
+
+// isFundingPending returns true if the instance was funded and its balance was
+// not checked since.
+func (in *Instance) isFundingPending() bool {
+	return atomic.LoadInt32(&in.fundingPending) == 1
+}
+
+// requestBalanceCheck schedules a balance check with priority.
+func (in *Instance) requestBalanceCheck() {
+	in.mu.RLock()
+	sdlr := in.sdlr
+	in.mu.RUnlock()
+	if sdlr == nil {
+		return
+	}
+	sdlr.PrioritySchedule(&scheduler.Command{
+		Value: balanceCheckCmdValue,
+		Log:   "re-checking balance for funding",
+	})
+}
+
+// fund shares coins with the instances of the cluster that are below their
+// minimum auto-share balance. Instances of which the balance is stale are asked
+// to check their balance and are funded in a later round instead, so nobody is
+// funded based on a balance that has changed in the meantime.
+func (in *Instance) fund() {
+	if in.isBalanceStale() {
+		in.requestBalanceCheck()
+		return
+	}
+	var needs []fundingNeed
+	for _, member := range in.Cluster {
+		if member == in ||
+			!member.Features.AutoShare.Enable ||
+			!member.Features.BalanceCheck.Enable ||
+			member.IsClosed() {
+			continue
+		}
+		if member.isBalanceStale() || member.isFundingPending() {
+			member.requestBalanceCheck()
+			continue
+		}
+		if deficit := member.Features.AutoShare.MinimumBalance - member.Balance(); deficit > 0 {
+			needs = append(needs, fundingNeed{to: member, deficit: deficit})
+		}
+	}
+
+	plan := planFunding(needs, in.Balance(), in.Compat.ShareTax)
+	if len(plan) == 0 {
+		return
+	}
+	sort.Slice(needs, func(i, j int) bool {
+		return needs[i].deficit > needs[j].deficit
+	})
+	var cmds []*scheduler.Command
+	for _, need := range needs {
+		amount, ok := plan[need.to]
+		if !ok {
+			continue
+		}
+		cmd := in.newShare(amount, need.to, "funding "+need.to.Client.User.Username)
+		cmd.Interval = time.Duration(in.Compat.Cooldown.Share) * time.Second
+		cmd.RescheduleAsPriority = true
+		cmds = append(cmds, cmd)
+		need.to.expectFunding()
+	}
+	in.sdlr.PrioritySchedule(in.newCmdChain(cmds, 0))
+}
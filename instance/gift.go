@@ -7,10 +7,10 @@
 package instance
 
 import (
+	"strconv"
 	"strings"
 
 	"github.com/dankgrinder/dankgrinder/discord"
-	"github.com/dankgrinder/dankgrinder/instance/scheduler"
 )
 
 func (in *Instance) gift(msg discord.Message) {
@@ -18,22 +18,33 @@ func (in *Instance) gift(msg discord.Message) {
 	if trigger == nil || !strings.Contains(trigger.Value, shopBaseCmdValue) {
 		return
 	}
-	if in == in.Master {
+	if !exp.gift.Match([]byte(msg.Embeds[0].Title)) || !exp.shop.Match([]byte(trigger.Value)) {
 		in.sdlr.Resume()
 		return
 	}
-	if !exp.gift.Match([]byte(msg.Embeds[0].Title)) || !exp.shop.Match([]byte(trigger.Value)) {
+	item := exp.shop.FindStringSubmatch(trigger.Value)[1]
+	route, target := in.giftRoute(item)
+	if target == nil {
+		in.sdlr.Resume()
+		return
+	}
+	owned, err := strconv.Atoi(strings.Replace(exp.gift.FindStringSubmatch(msg.Embeds[0].Title)[1], ",", "", -1))
+	if err != nil {
+		in.Logger.Errorf("error while reading amount of items owned: %v", err)
+		in.sdlr.Resume()
+		return
+	}
+	amount := owned - route.Keep
+	if route.Maximum > 0 && amount > route.Maximum {
+		amount = route.Maximum
+	}
+	if amount <= 0 {
 		in.sdlr.Resume()
 		return
 	}
-	amount := strings.Replace(exp.gift.FindStringSubmatch(msg.Embeds[0].Title)[1], ",", "", -1)
-	item := exp.shop.FindStringSubmatch(trigger.Value)[1]
 
 	// ResumeWithCommandOrPrioritySchedule is not necessary in this case because
 	// the scheduler has to be awaiting resume. AwaitResumeTrigger returns "" if
 	// the scheduler isn't awaiting resume which causes this function to return.
-	in.sdlr.ResumeWithCommand(&scheduler.Command{
-		Value: giftCmdValue(amount, item, in.Master.Client.User.ID),
-		Log:   "gifting items",
-	})
+	in.sdlr.ResumeWithCommand(in.newGift(amount, item, target, "gifting items to "+target.Client.User.Username))
 }
@@ -7,13 +7,109 @@
 package instance
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/dankgrinder/dankgrinder/analytics"
 	"github.com/dankgrinder/dankgrinder/discord"
 	"github.com/dankgrinder/dankgrinder/instance/scheduler"
 )
 
+const highlowStatsName = "highlow"
+
+// highlowStats keeps track of the wins and losses of highlow per range of
+// hints, so the answering strategy can be checked.
+type highlowStats struct {
+	mu      sync.Mutex
+	Buckets map[string]*highlowBucket `json:"buckets"`
+}
+
+type highlowBucket struct {
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+}
+
+func newHighlowStats() *highlowStats {
+	return &highlowStats{Buckets: map[string]*highlowBucket{}}
+}
+
+func (hs *highlowStats) record(bucket string, won bool) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	b, ok := hs.Buckets[bucket]
+	if !ok {
+		b = &highlowBucket{}
+		hs.Buckets[bucket] = b
+	}
+	if won {
+		b.Wins++
+		return
+	}
+	b.Losses++
+}
+
+// MarshalJSON makes sure the statistics are not modified while they are being
+// encoded.
+func (hs *highlowStats) MarshalJSON() ([]byte, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	return json.Marshal(struct {
+		Buckets map[string]*highlowBucket `json:"buckets"`
+	}{hs.Buckets})
+}
+
+// UnmarshalJSON makes sure the buckets map is never nil after decoding.
+func (hs *highlowStats) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Buckets map[string]*highlowBucket `json:"buckets"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.Buckets = v.Buckets
+	if hs.Buckets == nil {
+		hs.Buckets = map[string]*highlowBucket{}
+	}
+	return nil
+}
+
+// summary returns the win rate of every bucket, formatted to be used as log
+// fields.
+func (hs *highlowStats) summary() map[string]interface{} {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	res := map[string]interface{}{}
+	for bucket, b := range hs.Buckets {
+		games := b.Wins + b.Losses
+		if games == 0 {
+			continue
+		}
+		res[bucket] = fmt.Sprintf(
+			"%v%% of %v games",
+			int(math.Round(float64(b.Wins)/float64(games)*100)),
+			games,
+		)
+	}
+	return res
+}
+
+// highlowBucket returns the key of the range of hints n belongs to.
+func (in *Instance) highlowBucket(n int) string {
+	hl := in.Compat.Highlow
+	lower := hl.Minimum + (n-hl.Minimum)/hl.BucketSize*hl.BucketSize
+	upper := lower + hl.BucketSize - 1
+	if upper > hl.Maximum {
+		upper = hl.Maximum
+	}
+	return fmt.Sprintf("%v-%v", lower, upper)
+}
+
 func (in *Instance) hl(msg discord.Message) {
 	if !exp.hl.MatchString(msg.Embeds[0].Description) {
 		return
@@ -24,12 +120,46 @@ func (in *Instance) hl(msg discord.Message) {
 		in.Logger.Errorf("error while reading highlow hint: %v", err)
 		return
 	}
+	hl := in.Compat.Highlow
+	if n < hl.Minimum || n > hl.Maximum {
+		in.Logger.Errorf("highlow hint %v outside of configured range %v-%v", n, hl.Minimum, hl.Maximum)
+	}
 	res := "high"
-	if n > 50 {
+	if n > hl.Threshold {
 		res = "low"
+	} else if n == hl.Threshold && hl.Jackpot {
+		res = "jackpot"
 	}
+	in.pendingHighlow.set(in.highlowBucket(n))
 	in.sdlr.ResumeWithCommandOrPrioritySchedule(&scheduler.Command{
 		Value: res,
 		Log:   "responding to highlow",
 	})
 }
+
+// hlResult records whether the last highlow was won or lost.
+func (in *Instance) hlResult(msg discord.Message) {
+	bucket := in.pendingHighlow.peek(resultTimeout)
+	if bucket == "" {
+		return
+	}
+	match := exp.hlResult.FindStringSubmatch(msg.Embeds[0].Description)
+	if match == nil {
+		return
+	}
+	in.pendingHighlow.clear()
+
+	won := strings.ToLower(match[1]) == "won"
+	in.highlowStats.record(bucket, won)
+	if won {
+		coins, _, _ := parseOutcome(msg.Embeds[0].Description)
+		in.recordIncome(analytics.SourceHighlow, coins, 0)
+	}
+	in.Logger.WithFields(map[string]interface{}{
+		"hint": bucket,
+		"won":  won,
+	}).Infof("recorded highlow outcome")
+	if err := in.save(highlowStatsName, in.highlowStats); err != nil {
+		in.Logger.Errorf("error while saving highlow statistics: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"math"
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/analytics"
+	"github.com/dankgrinder/dankgrinder/discord"
+)
+
+// recordIncome adds the result of a command to the income of the instance and
+// appends it to the income history. items is the estimated value of the items
+// gained.
+func (in *Instance) recordIncome(source string, coins, items int) {
+	if coins == 0 && items == 0 {
+		return
+	}
+	r := analytics.Record{
+		Time:     time.Now(),
+		Instance: in.Client.User.ID,
+		Username: in.Client.User.Username,
+		Cluster:  in.ClusterName,
+		Source:   source,
+		Coins:    coins,
+		Items:    items,
+	}
+	in.income.Add(r)
+	if err := in.appendRecord(analytics.HistoryName, r); err != nil {
+		in.Logger.Errorf("error while saving income record: %v", err)
+	}
+}
+
+// itemsValue returns the estimated sell value of items, with one of each.
+// Items of which the price is unknown are not counted.
+func (in *Instance) itemsValue(items []string) int {
+	var value int
+	for _, item := range items {
+		if price, ok := in.prices.price(Item{Name: item}); ok {
+			value += price
+		}
+	}
+	return value
+}
+
+// incomeFields returns the average net income per hour of every source that
+// has income.
+func (in *Instance) incomeFields() map[string]interface{} {
+	s := in.income.Summary()
+	fields := map[string]interface{}{}
+	for _, source := range analytics.Sources {
+		t, ok := s.Sources[source]
+		if !ok {
+			continue
+		}
+		fields[source] = numFmt.Sprintf("%d", int(math.Round(s.Hourly(t.Net()))))
+	}
+	return fields
+}
+
+// HourlyIncome returns the average net income per hour of all sources together
+// since the instance started.
+func (in *Instance) HourlyIncome() int {
+	s := in.income.Summary()
+	return int(math.Round(s.Hourly(s.Total().Net())))
+}
+
+// begResult records the coins and items gained by begging.
+func (in *Instance) begResult(msg discord.Message) {
+	if msg.ReferencedMessage.Content != begCmdValue {
+		return
+	}
+	coins, _, items := parseOutcome(msg.Content, in.Client.User.Username)
+	in.recordIncome(analytics.SourceBeg, coins, in.itemsValue(items))
+	in.notifyRareItems(analytics.SourceBeg, items)
+}
+
+// fhSource returns the source of items brought back by fishing or hunting, or
+// an empty string if msg is not the result of either.
+func (in *Instance) fhSource(msg discord.Message) string {
+	value := ""
+	if msg.ReferencedMessage != nil {
+		value = msg.ReferencedMessage.Content
+	} else if trigger := in.sdlr.AwaitResumeTrigger(); trigger != nil {
+		value = trigger.Value
+	}
+	switch value {
+	case fishCmdValue:
+		return analytics.SourceFish
+	case huntCmdValue:
+		return analytics.SourceHunt
+	}
+	return ""
+}
@@ -11,20 +11,29 @@ import (
 	"math"
 	"math/rand"
 	"runtime"
-	"strconv"
 	"sync"
 	"time"
 
+	"github.com/dankgrinder/dankgrinder/analytics"
 	"github.com/dankgrinder/dankgrinder/config"
 
 	"github.com/dankgrinder/dankgrinder/discord"
+	"github.com/dankgrinder/dankgrinder/instance/blackjack"
 	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+	"github.com/dankgrinder/dankgrinder/journal"
+	"github.com/dankgrinder/dankgrinder/notify"
+	"github.com/dankgrinder/dankgrinder/store"
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 )
 
 const fundReqInterval = time.Minute * 10
 
+// maxShiftDur is the duration above which a shift is considered to last
+// forever. The last shift lasts for math.MaxInt64 if it has no duration, which
+// does not fit in a time.Time.
+const maxShiftDur = time.Hour * 24 * 365 * 100
+
 type Instance struct {
 	Client             *discord.Client
 	Logger             *logrus.Logger
@@ -37,15 +46,90 @@ type Instance struct {
 	Compat             config.Compat
 	Shifts             []config.Shift
 
+	// LogLevels overrides the level of the logs of components of the
+	// instance, see the config.LogComponent constants. Components without a
+	// level use the level of Logger.
+	LogLevels map[string]logrus.Level
+
+	// Name is used to refer to the instance in auto-gift and auto-share routes.
+	// It may be an empty string.
+	Name string
+
+	// ClusterName is the name of the cluster of the instance.
+	ClusterName string
+
+	// Coordinator gives access to the instances of other clusters. It is nil
+	// if coordination between clusters is disabled.
+	Coordinator *Coordinator
+
+	// Store persists state that should survive a restart, such as balances and
+	// the position in the shift cycle. If it is nil, state is saved to files in
+	// DataDir instead.
+	Store store.Store
+
+	// Journal records every command sent and every message of Dank Memer
+	// received. It is nil if the journal is disabled.
+	Journal *journal.Journal
+
+	// Notifier sends notifications about important events, such as fatal
+	// errors and rare items found. It is nil if notifications are disabled.
+	Notifier *notify.Notifier
+
+	// RareItems and RareItemValue decide which of the items found are rare,
+	// see config.Notifications.
+	RareItems     []string
+	RareItemValue int
+
+	// DataDir is the directory in which state that should survive a restart is
+	// saved. If it is an empty string, no state is saved.
+	DataDir string
+
 	sdlr              *scheduler.Scheduler
+	sdlrLog           *logrus.Entry
+	routerLog         *logrus.Entry
+	wsLog             *logrus.Entry
 	ws                *discord.WSConn
 	initialBalance    int
+	initialBank       int
+	initialNetWorth   int
+	netWorthSince     time.Time
 	balance           int
+	bank              int
+	bankCapacity      int
 	startingTime      time.Time
 	lastState         string
+	shiftEnd          time.Time
+	override          chan shiftOverride
+	paused            bool
 	lastBalanceUpdate time.Time
+	fundingPending    int32
 	fatal             chan error
 	isClosed          bool
+	searchStats       *choiceStats
+	pendingSearch     pendingChoice
+	postmemeStats     *choiceStats
+	pendingPostmeme   pendingChoice
+	highlowStats      *highlowStats
+	pendingHighlow    pendingChoice
+	bjTable           blackjack.Table
+	bankroll          bankroll
+	inventory         *Inventory
+	invPages          []Item
+	prices            *itemPrices
+	lastSell          time.Time
+	soldTotal         int
+	effects           effects
+	rewards           rewards
+	transfers         pendingTransfers
+	execs             commandExecs
+	income            analytics.Tracker
+	counters          counters
+	remoteWS          *discord.WSConn
+
+	// mu guards the balances, the shift state, the scheduler and the websocket
+	// connection. They are changed by the goroutines of the instance and read
+	// from others, for example by Metrics and by other instances.
+	mu sync.RWMutex
 }
 
 func (in *Instance) Start() error {
@@ -65,73 +149,106 @@ func (in *Instance) Start() error {
 		return fmt.Errorf("no logger")
 	}
 	if in.Master == nil {
-		if in.Features.AutoGift.Enable {
-			in.Logger.Warnf("nobody to auto-gift to, no master instance available")
+		if in.Features.AutoGift.Enable && len(in.Features.AutoGift.Items) > 0 {
+			in.Logger.Warnf("nobody to auto-gift items to, no master instance available")
 		}
-		if in.Features.AutoShare.Enable {
-			in.Logger.Warnf("nobody to auto-share to, no master instance available")
+		if in.Features.AutoShare.Enable && (in.Features.AutoShare.MaximumBalance > 0 || len(in.Features.AutoShare.Routes) == 0) {
+			in.Logger.Warnf("nobody to auto-share to above the maximum balance, no master instance available")
 		}
 	}
+	if in.Features.AutoSell.Enable && !in.Features.InventoryCheck.Enable && len(in.Features.AutoSell.MinimumStock) > 0 {
+		in.Logger.Warnf("auto-sell minimum stock is ignored, inventory checks are disabled so all of every item is sold")
+	}
+
+	in.initLoggers()
 
 	// For now, we assume that in.SuspicionAvoidance, in.Compat and in.Features
 	// are correct. They are currently validated in the main function. Ideally,
 	// this needs to change in the future.
 
+	if in.Features.AutoBlackjack.Enable {
+		t, err := blackjack.NewTable(in.Features.AutoBlackjack.Strategy, in.Features.AutoBlackjack.LogicTable)
+		if err != nil {
+			return fmt.Errorf("error while creating blackjack strategy table: %v", err)
+		}
+		in.bjTable = t
+		if err = in.load(blackjackRecordName, &in.bankroll.total); err != nil {
+			in.Logger.Errorf("error while loading blackjack record: %v", err)
+		}
+	}
+
+	in.inventory = &Inventory{}
+	in.prices = newItemPrices(in.Compat.ItemPrices)
+	in.searchStats, in.postmemeStats = newChoiceStats(), newChoiceStats()
+	if err := in.load(searchStatsName, in.searchStats); err != nil {
+		in.Logger.Errorf("error while loading search statistics: %v", err)
+	}
+	if err := in.load(postmemeStatsName, in.postmemeStats); err != nil {
+		in.Logger.Errorf("error while loading postmeme statistics: %v", err)
+	}
+	in.highlowStats = newHighlowStats()
+	if err := in.load(highlowStatsName, in.highlowStats); err != nil {
+		in.Logger.Errorf("error while loading highlow statistics: %v", err)
+	}
+
+	if err := in.load(rewardsStateName, &in.rewards.states); err != nil {
+		in.Logger.Errorf("error while loading rewards state: %v", err)
+	}
+	in.restoreState()
+	start, remaining, resumed := in.resumeShift()
+
 	in.fatal = make(chan error)
+	in.override = make(chan shiftOverride, 1)
+	if err := in.startRemoteControl(); err != nil {
+		return err
+	}
 	in.WG.Add(1)
 	go func() {
 		defer in.WG.Done()
 		defer func() {
+			in.stopRewards()
+			in.stopRemoteControl()
+			in.mu.Lock()
 			in.isClosed = true
+			in.mu.Unlock()
 		}()
 		for {
-			for i, shift := range in.Shifts {
+			for i := start; i < len(in.Shifts); i++ {
+				shift := in.Shifts[i]
 				dur := shiftDur(shift)
+				// The amount of custom commands is counted per active shift,
+				// so counts are only kept if an interrupted shift is resumed.
+				if resumed {
+					if remaining > 0 {
+						dur = remaining
+					}
+					resumed = false
+				} else {
+					in.resetExecs()
+				}
+				in.saveShift(i, dur)
 				in.Logger.WithFields(map[string]interface{}{
 					"state":    shift.State,
 					"duration": dur,
 				}).Infof("starting shift %v", i+1)
-				if shift.State == in.lastState {
-					in.sleep(dur)
-					continue
-				}
-				in.lastState = shift.State
-				if shift.State == config.ShiftStateDormant {
-					if in.ws != nil {
-						if err := in.ws.Close(); err != nil {
-							in.Logger.Errorf("error while closing websocket: %v", err)
-						}
-					}
-					if in.sdlr != nil {
-						if err := in.sdlr.Close(); err != nil {
-							in.Logger.Errorf("error while closing scheduler: %v", err)
-						}
-					}
-					in.sleep(dur)
-					continue
-				}
-				if err := in.startWS(); err != nil {
-					in.Logger.Errorf("instance fatal: error while starting websocket: %v", err)
-					return
-				}
-				if err := in.startSdlr(); err != nil {
-					in.Logger.Errorf("instance fatal: error while starting scheduler: %v", err)
+				if err := in.setState(shift.State, dur); err != nil {
+					in.instanceFatal(err)
 					return
 				}
-				cmds := in.newCmds()
-				if in.Features.AutoSell.Enable {
-					cmds = append(cmds, in.newAutoSellChain())
-				}
-				if in.Features.AutoGift.Enable &&
-					in.Master != nil &&
-					in != in.Master {
-					cmds = append(cmds, in.newAutoGiftChain())
-				}
-				for _, cmd := range cmds {
-					in.sdlr.Schedule(cmd)
+
+				// A forced shift replaces the remainder of the current shift.
+				for ovr := in.sleep(dur); ovr != nil; ovr = in.sleep(ovr.dur) {
+					in.Logger.WithFields(map[string]interface{}{
+						"state":    ovr.state,
+						"duration": ovr.dur,
+					}).Infof("starting forced shift")
+					if err := in.setState(ovr.state, ovr.dur); err != nil {
+						in.instanceFatal(err)
+						return
+					}
 				}
-				in.sleep(dur)
 			}
+			start = 0
 		}
 	}()
 	if in.Features.AutoShare.Enable && in.Features.AutoShare.Fund && in == in.Master {
@@ -140,67 +257,109 @@ func (in *Instance) Start() error {
 			defer t.Stop()
 			for {
 				<-t.C
-				var totalFunding int
-				var fundingCmds []*scheduler.Command
-				for _, clusterInstance := range in.Cluster {
-					if in == clusterInstance {
-						continue
-					}
-					if !clusterInstance.Features.AutoShare.Enable ||
-						clusterInstance.LastBalanceUpdate().IsZero() ||
-						clusterInstance.IsClosed() {
-						continue
-					}
-					balance := clusterInstance.Balance()
-					if balance >= clusterInstance.Features.AutoShare.MinimumBalance {
-						continue
-					}
-					deficit := clusterInstance.Features.AutoShare.MinimumBalance - balance
-					deficit = int(math.Round(float64(deficit) / 0.92)) // Account for 8% tax.
-					if totalFunding+deficit > in.balance {
-						break
-					}
-					totalFunding += deficit
-					fundingCmds = append(fundingCmds, &scheduler.Command{
-						Value:                shareCmdValue(strconv.Itoa(deficit), clusterInstance.Client.User.ID),
-						Log:                  "funding",
-						Interval:             time.Duration(in.Compat.Cooldown.Share) * time.Second,
-						RescheduleAsPriority: true,
-					})
-				}
-				if len(fundingCmds) > 0 {
-					in.sdlr.PrioritySchedule(in.newCmdChain(fundingCmds, 0))
-				}
+				in.fund()
 			}
 		}()
 	}
 	return nil
 }
 
-func (in *Instance) sleep(dur time.Duration) {
+// setState switches the instance to state for the duration of a shift. Nothing
+// is done if the instance is already in that state.
+func (in *Instance) setState(state string, dur time.Duration) error {
+	in.mu.Lock()
+	in.shiftEnd = time.Time{}
+	if dur < maxShiftDur {
+		in.shiftEnd = time.Now().Add(dur)
+	}
+	if state == in.lastState {
+		in.mu.Unlock()
+		return nil
+	}
+	in.lastState = state
+	in.mu.Unlock()
+	if state == config.ShiftStateDormant {
+		in.stopRewards()
+		if in.ws != nil {
+			if err := in.ws.Close(); err != nil {
+				in.wsLog.Errorf("error while closing websocket: %v", err)
+			}
+		}
+		if in.sdlr != nil {
+			if err := in.sdlr.Close(); err != nil {
+				in.Logger.Errorf("error while closing scheduler: %v", err)
+			}
+		}
+		return nil
+	}
+	if err := in.startWS(); err != nil {
+		return fmt.Errorf("error while starting websocket: %v", err)
+	}
+	if err := in.startSdlr(); err != nil {
+		return fmt.Errorf("error while starting scheduler: %v", err)
+	}
+	if in.Features.AutoBlackjack.Enable {
+		in.startBlackjackSession()
+	}
+	cmds := in.newCmds()
+	// With inventory checks, items are sold after every inventory check
+	// instead, see autoSell.
+	if in.Features.AutoSell.Enable && !in.Features.InventoryCheck.Enable {
+		cmds = append(cmds, in.newAutoSellChain())
+	}
+	if in.Features.AutoGift.Enable {
+		cmds = append(cmds, in.newAutoGiftChain())
+	}
+	for _, cmd := range cmds {
+		in.sdlr.Schedule(cmd)
+	}
+	in.scheduleRewards()
+	return nil
+}
+
+// sleep blocks for dur, or until a shift is forced, in which case the forced
+// shift is returned.
+func (in *Instance) sleep(dur time.Duration) *shiftOverride {
 	select {
 	case err := <-in.fatal:
-		in.Logger.Errorf("instance fatal: %v", err)
+		in.instanceFatal(err)
 		runtime.Goexit()
+	case ovr := <-in.override:
+		return &ovr
 	case <-time.After(dur):
 	}
+	return nil
 }
 
 func (in *Instance) startSdlr() error {
-	in.sdlr = &scheduler.Scheduler{
+	sdlr := &scheduler.Scheduler{
 		Client:             in.Client,
 		ChannelID:          in.ChannelID,
 		Typing:             &in.SuspicionAvoidance.Typing,
 		MessageDelay:       &in.SuspicionAvoidance.MessageDelay,
-		Logger:             in.Logger,
+		Logger:             in.sdlrLog,
 		AwaitResumeTimeout: time.Duration(in.Compat.AwaitResponseTimeout) * time.Second,
 		FatalHandler: func(ferr error) {
 			in.fatal <- fmt.Errorf("scheduler fatal: %v", ferr)
 		},
 	}
-	if err := in.sdlr.Start(); err != nil {
+	sdlr.SendHandler = in.handleSend
+	sdlr.TimeoutHandler = func(*scheduler.Command) {
+		in.counters.add(func(c *counters) {
+			c.timeouts++
+		})
+	}
+	// The scheduler is only published once it is started, so the control API
+	// and metrics never see it before its queues exist.
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.paused {
+		sdlr.Pause()
+	}
+	if err := sdlr.Start(); err != nil {
 		return fmt.Errorf("error while starting scheduler: %v", err)
 	}
+	in.sdlr = sdlr
 	return nil
 }
 
@@ -209,7 +368,9 @@ func (in *Instance) startWS() error {
 	if err != nil {
 		return fmt.Errorf("error while starting websocket: %v", err)
 	}
+	in.mu.Lock()
 	in.ws = ws
+	in.mu.Unlock()
 	return nil
 }
 
@@ -229,24 +390,36 @@ func (in *Instance) wsFatalHandler(err error) {
 		in.fatal <- fmt.Errorf("websocket closed: authentication failed, try using a new token")
 		return
 	}
-	in.Logger.Errorf("websocket closed: %v", err)
+	in.wsLog.Errorf("websocket closed: %v", err)
 
-	in.ws, err = in.Client.NewWSConn(in.router(), in.wsFatalHandler)
+	ws, err := in.Client.NewWSConn(in.router(), in.wsFatalHandler)
 	if err != nil {
 		in.fatal <- fmt.Errorf("error while connecting to websocket: %v", err)
 		return
 	}
-	in.Logger.Infof("reconnected to websocket")
+	in.mu.Lock()
+	in.ws = ws
+	in.mu.Unlock()
+	in.counters.add(func(c *counters) {
+		c.reconnects++
+	})
+	in.wsLog.Infof("reconnected to websocket")
 }
 
 func (in *Instance) IsClosed() bool {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
 	return in.isClosed
 }
 
 func (in *Instance) LastBalanceUpdate() time.Time {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
 	return in.lastBalanceUpdate
 }
 
 func (in *Instance) Balance() int {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
 	return in.balance
 }
@@ -0,0 +1,283 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/discord"
+	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+)
+
+// Inventory holds the items owned by an instance. It is filled in from the
+// inventory command and updated from the messages of commands which change the
+// amount of items owned in between.
+type Inventory struct {
+	mu         sync.Mutex
+	items      []*Item
+	lastUpdate time.Time
+}
+
+// Item is an item in an inventory. The ID is empty if the item was never seen in
+// the inventory command, because other commands only mention its name.
+type Item struct {
+	ID    string
+	Name  string
+	Count int
+}
+
+// itemKey normalizes an item id or name so they can be compared.
+func itemKey(s string) string {
+	return strings.ToLower(strings.Replace(s, " ", "", -1))
+}
+
+// find returns the item with an id or name equal to item. Must be called with
+// inv.mu locked.
+func (inv *Inventory) find(item string) *Item {
+	k := itemKey(item)
+	for _, it := range inv.items {
+		if (it.ID != "" && itemKey(it.ID) == k) || itemKey(it.Name) == k {
+			return it
+		}
+	}
+
+	// Names may be plural in some messages, for example "2 Fishing Poles".
+	if strings.HasSuffix(k, "s") {
+		return inv.find(strings.TrimSuffix(k, "s"))
+	}
+	return nil
+}
+
+// Count returns the amount owned of the item with the passed id or name.
+func (inv *Inventory) Count(item string) int {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if it := inv.find(item); it != nil {
+		return it.Count
+	}
+	return 0
+}
+
+// Item returns a copy of the item with the passed id or name. The second return
+// value is false if there is no such item.
+func (inv *Inventory) Item(item string) (Item, bool) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if it := inv.find(item); it != nil {
+		return *it, true
+	}
+	return Item{}, false
+}
+
+// Items returns a copy of all items with a count greater than 0, sorted by
+// name.
+func (inv *Inventory) Items() []Item {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	var res []Item
+	for _, it := range inv.items {
+		if it.Count > 0 {
+			res = append(res, *it)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// LastUpdate returns the time at which the inventory was last fully read from
+// the inventory command. It is the zero time if this has not happened yet.
+func (inv *Inventory) LastUpdate() time.Time {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return inv.lastUpdate
+}
+
+// replace replaces all items with items.
+func (inv *Inventory) replace(items []Item) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.items = nil
+	for i := range items {
+		it := items[i]
+		inv.items = append(inv.items, &it)
+	}
+	inv.lastUpdate = time.Now()
+}
+
+// add adds n to the count of item, which is an id or a name. n may be negative.
+func (inv *Inventory) add(item string, n int) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	it := inv.find(item)
+	if it == nil {
+		if n <= 0 {
+			return
+		}
+		it = &Item{Name: item}
+		inv.items = append(inv.items, it)
+	}
+	it.Count += n
+	if it.Count < 0 {
+		it.Count = 0
+	}
+}
+
+// set sets the count of item, which is an id or a name, to n.
+func (inv *Inventory) set(item string, n int) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	it := inv.find(item)
+	if it == nil {
+		it = &Item{Name: item}
+		inv.items = append(inv.items, it)
+	}
+	it.Count = n
+}
+
+// Inventory returns the inventory of the instance.
+func (in *Instance) Inventory() *Inventory {
+	return in.inventory
+}
+
+// inventoryCheck reads a page of the inventory command. If there are more pages
+// the next one is requested, otherwise the inventory is replaced with the items
+// read from all pages.
+func (in *Instance) inventoryCheck(msg discord.Message) {
+	embed := msg.Embeds[0]
+	author := strings.ToLower(clean(embed.Author.Name))
+	if !strings.Contains(author, strings.ToLower(in.Client.User.Username)) ||
+		!strings.Contains(author, "inventory") {
+		return
+	}
+	trigger := in.sdlr.AwaitResumeTrigger()
+	if trigger == nil || !strings.HasPrefix(trigger.Value, inventoryBaseCmdValue) {
+		return
+	}
+
+	text := embed.Description
+	for _, field := range embed.Fields {
+		text += "\n" + field.Name + "\n" + field.Value
+	}
+	page, pages := 1, 1
+	if match := exp.invPage.FindStringSubmatch(embed.Footer.Text); match != nil {
+		page, _ = strconv.Atoi(match[1])
+		pages, _ = strconv.Atoi(match[2])
+	}
+	if page == 1 {
+		in.invPages = nil
+	}
+	in.invPages = append(in.invPages, parseInventory(text)...)
+	if page < pages {
+		in.sdlr.ResumeWithCommand(&scheduler.Command{
+			Value:       inventoryCmdValue(strconv.Itoa(page + 1)),
+			Log:         "reading next inventory page",
+			AwaitResume: true,
+		})
+		return
+	}
+
+	items := in.invPages
+	in.invPages = nil
+	in.inventory.replace(items)
+	in.sdlr.Resume()
+	in.Logger.Infof("read inventory, %v different items owned", len(items))
+	if in.Features.AutoSell.Enable {
+		in.autoSell()
+	}
+}
+
+// parseInventory reads all items in the text of an inventory page. Every item
+// starts with its bold name followed by the amount owned, and is optionally
+// followed by its id.
+func parseInventory(text string) []Item {
+	var items []Item
+	matches := exp.invItem.FindAllStringSubmatchIndex(text, -1)
+	for i, m := range matches {
+		count, err := strconv.Atoi(strings.Replace(text[m[4]:m[5]], ",", "", -1))
+		if err != nil {
+			continue
+		}
+		end := len(text)
+		if i < len(matches)-1 {
+			end = matches[i+1][0]
+		}
+		it := Item{Name: strings.TrimSpace(clean(text[m[2]:m[3]])), Count: count}
+		if id := exp.invID.FindStringSubmatch(text[m[1]:end]); id != nil {
+			it.ID = id[1]
+		}
+		items = append(items, it)
+	}
+	return items
+}
+
+// inventoryChange updates the inventory from the message of a command which
+// changes the amount of an item owned, such as buying, selling or gifting.
+func (in *Instance) inventoryChange(msg discord.Message) {
+	if !in.isAddressed(msg) {
+		return
+	}
+	content := strings.ToLower(msg.Content)
+	var sign int
+	var source string
+	var value int
+	var found []string
+	switch {
+	case strings.Contains(content, "purchased") || strings.Contains(content, "bought"):
+		sign = 1
+	case strings.Contains(content, "brought back"):
+		sign = 1
+		source = in.fhSource(msg)
+	case strings.Contains(content, "sold"):
+		sign = -1
+		in.sellRevenue(msg.Content)
+	case strings.Contains(content, "you gave"):
+		sign = -1
+	default:
+		return
+	}
+	for _, match := range exp.invChange.FindAllStringSubmatch(msg.Content, -1) {
+		n := 1
+		if match[1] != "" {
+			var err error
+			if n, err = strconv.Atoi(strings.Replace(match[1], ",", "", -1)); err != nil {
+				continue
+			}
+		}
+		item, ok := outcomeItem(match[2], in.Client.User.Username)
+		if !ok {
+			continue
+		}
+		in.inventory.add(item, sign*n)
+		in.Logger.Debugf("inventory change: %v %v", sign*n, item)
+		if source != "" {
+			if price, ok := in.prices.price(Item{Name: item}); ok {
+				value += price * n
+			}
+			found = append(found, item)
+		}
+	}
+	if source != "" {
+		in.recordIncome(source, 0, value)
+		in.notifyRareItems(source, found)
+	}
+}
+
+// isAddressed returns true if msg mentions the instance's user or replies to one
+// of its messages.
+func (in *Instance) isAddressed(msg discord.Message) bool {
+	if msg.ReferencedMessage != nil && msg.ReferencedMessage.Author.ID == in.Client.User.ID {
+		return true
+	}
+	return strings.Contains(msg.Content, "<@"+in.Client.User.ID+">") ||
+		strings.Contains(msg.Content, "<@!"+in.Client.User.ID+">")
+}
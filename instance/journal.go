@@ -0,0 +1,58 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/discord"
+	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+	"github.com/dankgrinder/dankgrinder/journal"
+)
+
+// journalCommand records an attempt of the scheduler to send cmd.
+func (in *Instance) journalCommand(cmd *scheduler.Command, delay, typing time.Duration, err error) {
+	result := "sent"
+	if err != nil {
+		result = err.Error()
+	}
+	in.writeJournal(journal.Entry{
+		Kind:    journal.KindCommand,
+		Command: cmd.Value,
+		Delay:   delay.Milliseconds(),
+		Typing:  typing.Milliseconds(),
+		Result:  result,
+	})
+}
+
+// journalMessage records a message of Dank Memer in the channel of the instance
+// and the routes that handled it.
+func (in *Instance) journalMessage(msg discord.Message, eventType string, routes []string) {
+	if msg.ChannelID != in.ChannelID || msg.Author.ID != DMID {
+		return
+	}
+	e := journal.Entry{
+		Kind:      journal.KindMessage,
+		MessageID: msg.ID,
+		Event:     eventType,
+		Content:   msg.Content,
+		Routes:    routes,
+	}
+	if len(msg.Embeds) > 0 {
+		e.Embed = msg.Embeds[0].Title
+	}
+	in.writeJournal(e)
+}
+
+func (in *Instance) writeJournal(e journal.Entry) {
+	e.Instance = in.Client.User.ID
+	e.Username = in.Client.User.Username
+	e.Cluster = in.ClusterName
+	if err := in.Journal.Write(e); err != nil {
+		in.Logger.Errorf("error while writing journal entry: %v", err)
+	}
+}
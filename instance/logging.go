@@ -0,0 +1,75 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"github.com/dankgrinder/dankgrinder/config"
+	"github.com/dankgrinder/dankgrinder/discord"
+	"github.com/sirupsen/logrus"
+)
+
+// initLoggers applies the level of the instance component to Logger and
+// creates the loggers of the other components.
+func (in *Instance) initLoggers() {
+	if level, ok := in.LogLevels[config.LogComponentInstance]; ok {
+		in.Logger.SetLevel(level)
+	}
+	in.sdlrLog = in.componentLogger(config.LogComponentScheduler)
+	in.routerLog = in.componentLogger(config.LogComponentRouter)
+	in.wsLog = in.componentLogger(config.LogComponentWS)
+}
+
+// componentLogger returns a logger for component which writes to the same
+// output and hooks as Logger, at the level configured for the component in
+// LogLevels or otherwise the level of Logger.
+func (in *Instance) componentLogger(component string) *logrus.Entry {
+	l := logrus.New()
+	l.Out = in.Logger.Out
+	l.Formatter = in.Logger.Formatter
+	l.Hooks = in.Logger.Hooks
+	l.ExitFunc = in.Logger.ExitFunc
+	l.Level = in.Logger.GetLevel()
+	if level, ok := in.LogLevels[component]; ok {
+		l.Level = level
+	}
+	return l.WithField("component", component)
+}
+
+// logMessage logs a message of Dank Memer in the channel of the instance and
+// the routes that handled it.
+func (in *Instance) logMessage(msg discord.Message, eventType string, routes []string) {
+	if msg.ChannelID != in.ChannelID || msg.Author.ID != DMID {
+		return
+	}
+	in.routerLog.WithFields(map[string]interface{}{
+		"message_id":     msg.ID,
+		"event":          eventType,
+		"routes":         routes,
+		"correlation_id": in.correlationID(msg),
+	}).Debugf("routed message")
+}
+
+// correlationID returns the correlation id of the command msg responds to, or
+// an empty string if it is unknown. Dank Memer usually replies to the command,
+// otherwise the command awaiting a response is assumed.
+func (in *Instance) correlationID(msg discord.Message) string {
+	in.mu.RLock()
+	sdlr := in.sdlr
+	in.mu.RUnlock()
+	if sdlr == nil {
+		return ""
+	}
+	if ref := msg.ReferencedMessage; ref != nil && ref.Author.ID == in.Client.User.ID {
+		if last := sdlr.LastSent(); last != nil && last.Value == ref.Content {
+			return last.CorrelationID()
+		}
+	}
+	if trigger := sdlr.AwaitResumeTrigger(); trigger != nil {
+		return trigger.CorrelationID()
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/discord"
+	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+)
+
+// Metrics is a snapshot of the state and counters of an instance.
+type Metrics struct {
+	Balance  int
+	Bank     int
+	NetWorth int
+
+	// CommandsSent holds the amount of commands sent per command type, see
+	// commandType.
+	CommandsSent map[string]uint64
+
+	// SendErrors holds the amount of commands that could not be sent per
+	// class of error, see errorClass.
+	SendErrors map[string]uint64
+
+	RateLimitWaits      uint64
+	AwaitResumeTimeouts uint64
+	Reconnects          uint64
+	QueueDepth          int
+	HeartbeatLatency    time.Duration
+
+	// ShiftState is the state of the current shift, or an empty string if the
+	// first shift has not started yet.
+	ShiftState string
+}
+
+type counters struct {
+	mu             sync.Mutex
+	sent           map[string]uint64
+	errors         map[string]uint64
+	rateLimitWaits uint64
+	timeouts       uint64
+	reconnects     uint64
+}
+
+func (c *counters) add(f func(c *counters)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sent == nil {
+		c.sent, c.errors = map[string]uint64{}, map[string]uint64{}
+	}
+	f(c)
+}
+
+// commandType returns the name of the Dank Memer command of value, such as beg
+// for "pls beg" and sell for "pls sell max fish". Values which are not a Dank
+// Memer command, such as responses to games and events, are of type response.
+func commandType(value string) string {
+	fields := strings.Fields(strings.ToLower(value))
+	if len(fields) < 2 || fields[0] != "pls" {
+		return "response"
+	}
+	return fields[1]
+}
+
+// errorClass returns a short name for an error returned while sending a
+// command.
+func errorClass(err error) string {
+	switch err {
+	case discord.ErrForbidden:
+		return "forbidden"
+	case discord.ErrUnauthorized:
+		return "unauthorized"
+	case discord.ErrNotFound:
+		return "not_found"
+	case discord.ErrTooManyRequests:
+		return "too_many_requests"
+	case discord.ErrIntervalServer:
+		return "internal_server_error"
+	}
+	return "other"
+}
+
+// handleSend is called by the scheduler after every attempt to send a command.
+func (in *Instance) handleSend(cmd *scheduler.Command, delay, typing time.Duration, err error) {
+	if in.Journal != nil {
+		in.journalCommand(cmd, delay, typing, err)
+	}
+	if err == scheduler.ErrCondition {
+		return
+	}
+	in.counters.add(func(c *counters) {
+		if err == nil {
+			c.sent[commandType(cmd.Value)]++
+			return
+		}
+		c.errors[errorClass(err)]++
+		if err == discord.ErrTooManyRequests {
+			c.rateLimitWaits++
+		}
+	})
+}
+
+// Metrics returns a snapshot of the state and counters of the instance.
+func (in *Instance) Metrics() Metrics {
+	in.mu.RLock()
+	m := Metrics{
+		Balance:      in.balance,
+		Bank:         in.bank,
+		CommandsSent: map[string]uint64{},
+		SendErrors:   map[string]uint64{},
+		ShiftState:   in.lastState,
+	}
+	sdlr, ws := in.sdlr, in.ws
+	in.mu.RUnlock()
+	if in.prices != nil {
+		m.NetWorth = in.NetWorth()
+	}
+	if sdlr != nil {
+		m.QueueDepth = sdlr.QueueLen()
+	}
+	if ws != nil {
+		m.HeartbeatLatency = ws.Latency()
+	}
+	in.counters.add(func(c *counters) {
+		for k, v := range c.sent {
+			m.CommandsSent[k] = v
+		}
+		for k, v := range c.errors {
+			m.SendErrors[k] = v
+		}
+		m.RateLimitWaits = c.rateLimitWaits
+		m.AwaitResumeTimeouts = c.timeouts
+		m.Reconnects = c.reconnects
+	})
+	return m
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dankgrinder/dankgrinder/discord"
+)
+
+// itemPrices holds the sell and buy prices of items, keyed by itemKey. Sell
+// prices read from the shop are only used for items without a configured price.
+type itemPrices struct {
+	mu         sync.Mutex
+	configured map[string]int
+	observed   map[string]int
+	buy        map[string]int
+}
+
+func newItemPrices(configured map[string]int) *itemPrices {
+	p := &itemPrices{
+		configured: map[string]int{},
+		observed:   map[string]int{},
+		buy:        map[string]int{},
+	}
+	for item, price := range configured {
+		p.configured[itemKey(item)] = price
+	}
+	return p
+}
+
+func (p *itemPrices) set(item string, price int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.observed[itemKey(item)] = price
+}
+
+func (p *itemPrices) setBuy(item string, price int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buy[itemKey(item)] = price
+}
+
+// buyPrice returns the price at which item can be bought. The second return
+// value is false if the price is unknown.
+func (p *itemPrices) buyPrice(item string) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	price, ok := p.buy[itemKey(item)]
+	return price, ok
+}
+
+// price returns the sell price of it. The second return value is false if the
+// price is unknown.
+func (p *itemPrices) price(it Item) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, k := range []string{itemKey(it.ID), itemKey(it.Name)} {
+		if k == "" {
+			continue
+		}
+		if price, ok := p.configured[k]; ok {
+			return price, true
+		}
+		if price, ok := p.observed[k]; ok {
+			return price, true
+		}
+	}
+	return 0, false
+}
+
+// shopItem reads the amount owned and the prices of an item from the embed
+// of the shop command. Instances often share a channel, so the embed is only
+// read if the instance awaits a shop command or the embed is addressed to it.
+func (in *Instance) shopItem(msg discord.Message) {
+	trigger := in.sdlr.AwaitResumeTrigger()
+	if (trigger == nil || !strings.HasPrefix(trigger.Value, shopBaseCmdValue)) && !in.isAddressed(msg) {
+		return
+	}
+	match := exp.shopItem.FindStringSubmatch(msg.Embeds[0].Title)
+	if match == nil {
+		return
+	}
+	item := strings.TrimSpace(clean(match[1]))
+	if n, err := strconv.Atoi(strings.Replace(match[2], ",", "", -1)); err == nil {
+		in.inventory.set(item, n)
+	}
+	if sell := exp.shopSell.FindStringSubmatch(msg.Embeds[0].Description); sell != nil {
+		if price, err := strconv.Atoi(strings.Replace(sell[1], ",", "", -1)); err == nil {
+			in.prices.set(item, price)
+		}
+	}
+	if buy := exp.shopBuy.FindStringSubmatch(msg.Embeds[0].Description); buy != nil {
+		if price, err := strconv.Atoi(strings.Replace(buy[1], ",", "", -1)); err == nil {
+			in.prices.setBuy(item, price)
+		}
+	}
+}
+
+// inventoryValue returns the total sell value of the inventory and the amount of
+// different items of which the price is unknown.
+func (in *Instance) inventoryValue() (value, unpriced int) {
+	for _, it := range in.inventory.Items() {
+		price, ok := in.prices.price(it)
+		if !ok {
+			unpriced++
+			continue
+		}
+		value += price * it.Count
+	}
+	return value, unpriced
+}
+
+// Bank returns the last known bank balance.
+func (in *Instance) Bank() int {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	return in.bank
+}
+
+// NetWorth returns the estimated net worth, which is the wallet and bank balance
+// plus the sell value of the inventory.
+func (in *Instance) NetWorth() int {
+	value, _ := in.inventoryValue()
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	return in.balance + in.bank + value
+}
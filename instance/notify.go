@@ -0,0 +1,62 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dankgrinder/dankgrinder/notify"
+)
+
+// notify sends a notification of kind with a formatted message, if
+// notifications are enabled.
+func (in *Instance) notify(kind, format string, args ...interface{}) {
+	if in.Notifier == nil {
+		return
+	}
+	in.Notifier.Notify(notify.Event{
+		Kind:     kind,
+		Instance: in.Client.User.ID,
+		Username: in.Client.User.Username,
+		Cluster:  in.ClusterName,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// instanceFatal logs the error which stopped the instance and sends a
+// notification about it.
+func (in *Instance) instanceFatal(err error) {
+	in.Logger.Errorf("instance fatal: %v", err)
+	in.notify(notify.EventFatal, "instance stopped: %v", err)
+}
+
+// notifyRareItems sends a notification for every rare item in items. An item
+// is rare if it is one of RareItems or worth at least RareItemValue.
+func (in *Instance) notifyRareItems(source string, items []string) {
+	if in.Notifier == nil {
+		return
+	}
+	for _, item := range items {
+		price, known := in.prices.price(Item{Name: item})
+		rare := in.RareItemValue > 0 && known && price >= in.RareItemValue
+		for _, name := range in.RareItems {
+			if strings.EqualFold(name, item) {
+				rare = true
+				break
+			}
+		}
+		if !rare {
+			continue
+		}
+		if known {
+			in.notify(notify.EventRareItem, "found %v worth %v with %v", item, numFmt.Sprintf("%d", price), source)
+			continue
+		}
+		in.notify(notify.EventRareItem, "found %v with %v", item, source)
+	}
+}
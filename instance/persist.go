@@ -0,0 +1,108 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// load decodes the persisted state with the passed name into v. If a store is
+// set, the state is read from it, falling back to the state file written by
+// older versions. Nothing is done if persistence is disabled or if the state was
+// never saved before.
+func (in *Instance) load(name string, v interface{}) error {
+	if in.Store != nil {
+		ok, err := in.Store.Get(in.Client.User.ID, name, v)
+		if err != nil {
+			return fmt.Errorf("error while loading %v state: %v", name, err)
+		}
+		if ok {
+			return nil
+		}
+	}
+	if in.DataDir == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(in.statePath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error while reading %v state: %v", name, err)
+	}
+	if err = json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("error while decoding %v state: %v", name, err)
+	}
+	return nil
+}
+
+// save persists v under the passed name so it can be loaded again after a
+// restart. If a store is set, v is saved to it instead of a state file. Nothing
+// is done if persistence is disabled.
+func (in *Instance) save(name string, v interface{}) error {
+	if in.Store != nil {
+		if err := in.Store.Put(in.Client.User.ID, name, v); err != nil {
+			return fmt.Errorf("error while saving %v state: %v", name, err)
+		}
+		return nil
+	}
+	if in.DataDir == "" {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error while encoding %v state: %v", name, err)
+	}
+	dir := path.Join(in.DataDir, in.Client.User.ID)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error while creating data dir: %v", err)
+	}
+
+	// Write to a temporary file first so a crash while writing does not leave
+	// a corrupt state file behind.
+	tmp := in.statePath(name) + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("error while writing %v state: %v", name, err)
+	}
+	if err = os.Rename(tmp, in.statePath(name)); err != nil {
+		return fmt.Errorf("error while writing %v state: %v", name, err)
+	}
+	return nil
+}
+
+func (in *Instance) statePath(name string) string {
+	return path.Join(in.DataDir, in.Client.User.ID, name+".json")
+}
+
+// appendRecord appends v as a line of JSON to the log with the passed name.
+// Nothing is done if persistence is disabled.
+func (in *Instance) appendRecord(name string, v interface{}) error {
+	if in.DataDir == "" {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error while encoding %v record: %v", name, err)
+	}
+	dir := path.Join(in.DataDir, in.Client.User.ID)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error while creating data dir: %v", err)
+	}
+	f, err := os.OpenFile(path.Join(dir, name+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error while opening %v log: %v", name, err)
+	}
+	defer f.Close()
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("error while writing %v record: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"math/rand"
+	"strings"
+
+	"github.com/dankgrinder/dankgrinder/analytics"
+	"github.com/dankgrinder/dankgrinder/config"
+	"github.com/dankgrinder/dankgrinder/discord"
+	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+)
+
+const postmemeStatsName = "postmeme"
+
+func (in *Instance) pm(_ discord.Message) {
+	res := in.postmemeChoice()
+	in.pendingPostmeme.set(res)
+	in.sdlr.ResumeWithCommandOrPrioritySchedule(&scheduler.Command{
+		Value: res,
+		Log:   "responding to postmeme",
+	})
+}
+
+// postmemeChoice picks one of the postmeme options according to the
+// configured postmeme strategy.
+func (in *Instance) postmemeChoice() string {
+	opts := in.Compat.PostmemeOpts
+	strategy := in.Compat.PostmemeStrategy
+	switch strategy.Strategy {
+	case config.StrategyWeighted:
+		var total float64
+		for _, opt := range opts {
+			total += postmemeWeight(strategy, opt)
+		}
+		r := rand.Float64() * total
+		for _, opt := range opts {
+			r -= postmemeWeight(strategy, opt)
+			if r < 0 {
+				return opt
+			}
+		}
+	case config.StrategyBestEV, config.StrategyEpsilonGreedy:
+		if strategy.Strategy == config.StrategyEpsilonGreedy && explore(strategy.Epsilon) {
+			break
+		}
+		choice, _ := in.postmemeStats.best(opts, 0, strategy.MinimumSamples, func(_ string) bool {
+			return true
+		})
+		if choice != "" {
+			return choice
+		}
+	}
+	return opts[rand.Intn(len(opts))]
+}
+
+func postmemeWeight(strategy config.PostmemeStrategy, opt string) float64 {
+	weight, ok := strategy.Weights[opt]
+	if !ok {
+		return 1
+	}
+	return weight
+}
+
+// pmResult records the outcome of the last postmeme, so it can be used by the
+// postmeme strategy for future choices. Results of other users are ignored.
+func (in *Instance) pmResult(msg discord.Message) {
+	if !in.isAddressed(msg) {
+		return
+	}
+	choice := in.pendingPostmeme.peek(resultTimeout)
+	if choice == "" || strings.Contains(msg.Content, "What type of meme do you want to post") {
+		return
+	}
+	if !exp.pmResult.MatchString(msg.Content) {
+		return
+	}
+	in.pendingPostmeme.clear()
+
+	coins, _, items := parseOutcome(msg.Content, in.Client.User.Username)
+	in.postmemeStats.record(choice, coins, false, items)
+	for _, item := range items {
+		in.inventory.add(item, 1)
+	}
+	in.recordIncome(analytics.SourcePostmeme, coins, in.itemsValue(items))
+	in.notifyRareItems(analytics.SourcePostmeme, items)
+	in.Logger.WithFields(map[string]interface{}{
+		"type":  choice,
+		"coins": coins,
+		"items": items,
+	}).Infof("recorded postmeme outcome")
+	if err := in.save(postmemeStatsName, in.postmemeStats); err != nil {
+		in.Logger.Errorf("error while saving postmeme statistics: %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/config"
+	"github.com/dankgrinder/dankgrinder/discord"
+	"github.com/gorilla/websocket"
+)
+
+// maxReplyLen is the maximum length of a single reply to a remote control
+// command. Discord rejects messages longer than 2000 characters.
+const maxReplyLen = 1900
+
+const remoteHelp = "```\n" +
+	"%[1]v status                          state of every instance\n" +
+	"%[1]v balance                         balances and hourly income\n" +
+	"%[1]v pause <name|all>                stop sending commands\n" +
+	"%[1]v resume <name|all>               send commands again\n" +
+	"%[1]v run <name> <command>            send a command once\n" +
+	"%[1]v shift <name> <state> <minutes>  force an active or dormant shift\n" +
+	"```"
+
+// startRemoteControl connects the websocket which handles remote control
+// commands, if the instance is a master with remote control enabled. It is
+// separate from the websocket of the active shifts, so commands are also
+// handled during dormant shifts.
+func (in *Instance) startRemoteControl() error {
+	if in != in.Master || !in.Features.RemoteControl.Enable {
+		return nil
+	}
+	ws, err := in.Client.NewWSConn(in.remoteRouter(), in.remoteWSFatalHandler)
+	if err != nil {
+		return fmt.Errorf("error while starting remote control websocket: %v", err)
+	}
+	in.mu.Lock()
+	in.remoteWS = ws
+	in.mu.Unlock()
+	return nil
+}
+
+// stopRemoteControl closes the remote control websocket, if any.
+func (in *Instance) stopRemoteControl() {
+	in.mu.Lock()
+	ws := in.remoteWS
+	in.remoteWS = nil
+	in.mu.Unlock()
+	if ws == nil {
+		return
+	}
+	if err := ws.Close(); err != nil {
+		in.wsLog.Errorf("error while closing remote control websocket: %v", err)
+	}
+}
+
+func (in *Instance) remoteWSFatalHandler(err error) {
+	if closeErr, ok := err.(*websocket.CloseError); ok && closeErr.Code == 4004 {
+		in.fatal <- fmt.Errorf("remote control websocket closed: authentication failed, try using a new token")
+		return
+	}
+	in.wsLog.Errorf("remote control websocket closed: %v", err)
+	if err = in.startRemoteControl(); err != nil {
+		in.fatal <- err
+		return
+	}
+	in.wsLog.Infof("reconnected to remote control websocket")
+}
+
+// remotePrefix returns the prefix of remote control commands configured in rc.
+func remotePrefix(rc config.RemoteControl) string {
+	if rc.Prefix == "" {
+		return config.DefaultRemoteControlPrefix
+	}
+	return rc.Prefix
+}
+
+// remoteRouter returns the router that handles remote control commands sent by
+// the owners configured in Features.RemoteControl.
+func (in *Instance) remoteRouter() *discord.MessageRouter {
+	rtr := &discord.MessageRouter{}
+	opts := in.Features.RemoteControl
+	prefix := remotePrefix(opts)
+	for _, owner := range opts.Owners {
+		rtr.NewRoute().
+			Name("remote control").
+			EventType(discord.EventNameMessageCreate).
+			Author(owner).
+			Handler(func(msg discord.Message) {
+				// Commands are accepted in the control channel and in direct
+				// messages, which have no guild.
+				if msg.ChannelID != opts.ChannelID && msg.GuildID != "" {
+					return
+				}
+				args := strings.Fields(msg.Content)
+				if len(args) == 0 || args[0] != prefix {
+					return
+				}
+				if msg.GuildID != "" && in.remoteResponder(msg) != in {
+					return
+				}
+				in.Logger.Infof("received remote control command: %v", msg.Content)
+				in.reply(msg.ChannelID, in.remoteCommand(prefix, args[1:]))
+			})
+	}
+	return rtr
+}
+
+// remoteResponder returns the master which replies to the remote control
+// command msg sent in a channel. If clusters are coordinated, the masters of
+// several clusters may receive the same command, in which case only the first
+// running master by cluster name that accepts it replies. Direct messages are
+// only received by the master they are sent to.
+func (in *Instance) remoteResponder(msg discord.Message) *Instance {
+	if in.Coordinator == nil {
+		return in
+	}
+	args := strings.Fields(msg.Content)
+	for _, name := range in.Coordinator.Clusters() {
+		master, _, _ := in.Coordinator.Cluster(name)
+		if master == nil || master.IsClosed() {
+			continue
+		}
+		rc := master.Features.RemoteControl
+		if !rc.Enable || rc.ChannelID != msg.ChannelID || remotePrefix(rc) != args[0] {
+			continue
+		}
+		for _, owner := range rc.Owners {
+			if owner == msg.Author.ID {
+				return master
+			}
+		}
+	}
+	return in
+}
+
+// remoteCommand executes the remote control command args and returns the
+// reply.
+func (in *Instance) remoteCommand(prefix string, args []string) string {
+	if len(args) == 0 {
+		return fmt.Sprintf(remoteHelp, prefix)
+	}
+	switch strings.ToLower(args[0]) {
+	case "status":
+		var b strings.Builder
+		for _, target := range in.remoteTargets() {
+			s := target.Status()
+			state := s.State
+			if s.Closed {
+				state = "closed"
+			} else if s.Paused {
+				state += ", paused"
+			}
+			fmt.Fprintf(&b, "**%v** (%v): %v", remoteName(target), s.Cluster, state)
+			if !s.ShiftEnd.IsZero() {
+				fmt.Fprintf(&b, " for %v", time.Until(s.ShiftEnd).Round(time.Minute))
+			}
+			fmt.Fprintf(&b, ", %v queued\n", s.Queued)
+		}
+		return b.String()
+	case "balance", "bal":
+		var b strings.Builder
+		var total, hourly int
+		for _, target := range in.remoteTargets() {
+			s := target.Status()
+			fmt.Fprintf(
+				&b,
+				"**%v**: wallet %v, bank %v, net worth %v, %v/h\n",
+				remoteName(target),
+				s.Balance,
+				s.Bank,
+				s.NetWorth,
+				s.HourlyIncome,
+			)
+			total += s.NetWorth
+			hourly += s.HourlyIncome
+		}
+		fmt.Fprintf(&b, "total net worth %v, %v/h", total, hourly)
+		return b.String()
+	case "pause", "resume":
+		if len(args) != 2 {
+			return fmt.Sprintf("usage: %v %v <name|all>", prefix, args[0])
+		}
+		var targets []*Instance
+		if strings.EqualFold(args[1], "all") {
+			targets = in.remoteTargets()
+		} else if target, ok := in.findTarget(args[1]); ok {
+			targets = []*Instance{target}
+		} else {
+			return fmt.Sprintf("no instance %v", args[1])
+		}
+		var names []string
+		for _, target := range targets {
+			if strings.EqualFold(args[0], "pause") {
+				target.Pause()
+			} else {
+				target.Resume()
+			}
+			names = append(names, remoteName(target))
+		}
+		return fmt.Sprintf("%vd %v", strings.ToLower(args[0]), strings.Join(names, ", "))
+	case "run":
+		if len(args) < 3 {
+			return fmt.Sprintf("usage: %v run <name> <command>", prefix)
+		}
+		target, ok := in.findTarget(args[1])
+		if !ok {
+			return fmt.Sprintf("no instance %v", args[1])
+		}
+		cmd := strings.Join(args[2:], " ")
+		if err := target.Run(cmd); err != nil {
+			return fmt.Sprintf("error while running command: %v", err)
+		}
+		return fmt.Sprintf("queued `%v` on %v", cmd, remoteName(target))
+	case "shift":
+		if len(args) != 4 {
+			return fmt.Sprintf("usage: %v shift <name> <active|dormant> <minutes>", prefix)
+		}
+		target, ok := in.findTarget(args[1])
+		if !ok {
+			return fmt.Sprintf("no instance %v", args[1])
+		}
+		minutes, err := strconv.Atoi(args[3])
+		if err != nil {
+			return fmt.Sprintf("invalid duration: %v", args[3])
+		}
+		if err = target.ForceShift(strings.ToLower(args[2]), time.Duration(minutes)*time.Minute); err != nil {
+			return fmt.Sprintf("error while forcing shift: %v", err)
+		}
+		return fmt.Sprintf("forced %v shift of %v minutes on %v", args[2], minutes, remoteName(target))
+	case "help":
+		return fmt.Sprintf(remoteHelp, prefix)
+	}
+	return fmt.Sprintf("unknown command %v, try %v help", args[0], prefix)
+}
+
+// remoteTargets returns the instances that can be controlled remotely: those of
+// every cluster if clusters are coordinated, otherwise those of the cluster of
+// the instance.
+func (in *Instance) remoteTargets() []*Instance {
+	if in.Coordinator == nil {
+		return in.Cluster
+	}
+	var targets []*Instance
+	for _, name := range in.Coordinator.Clusters() {
+		_, instances, _ := in.Coordinator.Cluster(name)
+		targets = append(targets, instances...)
+	}
+	return targets
+}
+
+// findTarget returns the instance with key as its user id, name or username.
+func (in *Instance) findTarget(key string) (*Instance, bool) {
+	targets := in.remoteTargets()
+	for _, target := range targets {
+		if target.Client.User.ID == key {
+			return target, true
+		}
+	}
+	for _, target := range targets {
+		if (target.Name != "" && strings.EqualFold(target.Name, key)) ||
+			strings.EqualFold(target.Client.User.Username, key) {
+			return target, true
+		}
+	}
+	return nil, false
+}
+
+func remoteName(in *Instance) string {
+	if in.Name != "" {
+		return in.Name
+	}
+	return in.Client.User.Username
+}
+
+// reply sends content to channelID, split over several messages if it is too
+// long for one.
+func (in *Instance) reply(channelID, content string) {
+	for content != "" {
+		part := content
+		if len(part) > maxReplyLen {
+			part = part[:maxReplyLen]
+			if i := strings.LastIndex(part, "\n"); i > 0 {
+				part = part[:i]
+			}
+		}
+		content = strings.TrimPrefix(content[len(part):], "\n")
+		if err := in.Client.SendMessage(part, channelID, 0); err != nil {
+			in.Logger.Errorf("error while replying to remote control command: %v", err)
+			return
+		}
+	}
+}
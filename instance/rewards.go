@@ -0,0 +1,202 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/discord"
+	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+)
+
+const rewardsStateName = "rewards"
+
+// rewardRetry is how long to wait before claiming a reward again if the claim
+// was not answered.
+const rewardRetry = time.Minute * 10
+
+// rewardPeriods maps the rewards to the time between two claims.
+var rewardPeriods = map[string]time.Duration{
+	"daily":   time.Hour * 24,
+	"weekly":  time.Hour * 24 * 7,
+	"monthly": time.Hour * 24 * 30,
+}
+
+// rewardState is the persisted state of a reward.
+type rewardState struct {
+	Last   time.Time `json:"last"`   // The time of the last successful claim.
+	Next   time.Time `json:"next"`   // The time at which the reward can be claimed again.
+	Streak int       `json:"streak"` // The current streak, 0 if unknown.
+}
+
+// rewards keeps track of when rewards can be claimed and holds the timers which
+// schedule the claims.
+type rewards struct {
+	mu     sync.Mutex
+	states map[string]*rewardState
+	timers map[string]*time.Timer
+}
+
+// enabledRewards returns the names of the enabled rewards.
+func (in *Instance) enabledRewards() []string {
+	if !in.Features.Rewards.Enable {
+		return nil
+	}
+	var names []string
+	if in.Features.Rewards.Daily {
+		names = append(names, "daily")
+	}
+	if in.Features.Rewards.Weekly {
+		names = append(names, "weekly")
+	}
+	if in.Features.Rewards.Monthly {
+		names = append(names, "monthly")
+	}
+	return names
+}
+
+// scheduleRewards arms a timer for every enabled reward which schedules its
+// claim once it is available. Timers armed before are stopped, so this can be
+// called at the start of every active shift.
+func (in *Instance) scheduleRewards() {
+	in.rewards.mu.Lock()
+	defer in.rewards.mu.Unlock()
+	for _, name := range in.enabledRewards() {
+		var next time.Time
+		if state := in.rewards.states[name]; state != nil {
+			next = state.Next
+		}
+		in.armReward(name, next)
+	}
+}
+
+// armReward arms the timer of reward name to schedule its claim at next. Must be
+// called with in.rewards.mu locked.
+func (in *Instance) armReward(name string, next time.Time) {
+	if in.rewards.timers == nil {
+		in.rewards.timers = map[string]*time.Timer{}
+	}
+	if t := in.rewards.timers[name]; t != nil {
+		t.Stop()
+	}
+	var t *time.Timer
+	t = time.AfterFunc(time.Until(next), func() {
+		in.rewards.mu.Lock()
+		// The timer may have fired while it was being stopped.
+		if in.rewards.timers[name] != t {
+			in.rewards.mu.Unlock()
+			return
+		}
+		in.armReward(name, time.Now().Add(rewardRetry))
+		in.rewards.mu.Unlock()
+		in.sdlr.Schedule(&scheduler.Command{
+			Value:       rewardCmdValue(name),
+			Log:         "claiming " + name + " reward",
+			AwaitResume: true,
+		})
+	})
+	in.rewards.timers[name] = t
+}
+
+// stopRewards stops the timers of all rewards. It is called whenever the
+// scheduler is closed, the timers are armed again by scheduleRewards at the
+// start of the next active shift.
+func (in *Instance) stopRewards() {
+	in.rewards.mu.Lock()
+	defer in.rewards.mu.Unlock()
+	for name, t := range in.rewards.timers {
+		t.Stop()
+		delete(in.rewards.timers, name)
+	}
+}
+
+// reward handles the response to claiming a reward. If the reward was claimed
+// before, the time at which it can be claimed again is read from the response.
+// The next claim is scheduled accordingly. Responses to other users are
+// ignored.
+func (in *Instance) reward(msg discord.Message) {
+	if !in.isAddressed(msg) {
+		return
+	}
+	trigger := in.sdlr.AwaitResumeTrigger()
+	if trigger == nil {
+		return
+	}
+	var name string
+	for n := range rewardPeriods {
+		if trigger.Value == rewardCmdValue(n) {
+			name = n
+		}
+	}
+	if name == "" {
+		return
+	}
+	content := msg.Content
+	for _, embed := range msg.Embeds {
+		content += "\n" + embed.Title + "\n" + embed.Description + "\n" + embed.Footer.Text
+	}
+	in.sdlr.Resume()
+
+	in.rewards.mu.Lock()
+	defer in.rewards.mu.Unlock()
+	if in.rewards.states == nil {
+		in.rewards.states = map[string]*rewardState{}
+	}
+	state := in.rewards.states[name]
+	if state == nil {
+		state = &rewardState{}
+		in.rewards.states[name] = state
+	}
+	if wait, ok := parseComeBack(content); ok {
+		state.Next = time.Now().Add(wait)
+		in.Logger.Infof("%v reward already claimed, claiming again in %v", name, wait)
+	} else {
+		prev := state.Last
+		state.Last = time.Now()
+		state.Next = state.Last.Add(rewardPeriods[name])
+		if match := exp.rewardStreak.FindStringSubmatch(content); match != nil {
+			state.Streak, _ = strconv.Atoi(strings.Replace(match[1], ",", "", -1))
+		} else if !prev.IsZero() && state.Last.Sub(prev) < 2*rewardPeriods[name] {
+			state.Streak++
+		} else {
+			state.Streak = 1
+		}
+		in.Logger.Infof("claimed %v reward, streak: %v", name, state.Streak)
+	}
+	in.armReward(name, state.Next)
+	if err := in.save(rewardsStateName, in.rewards.states); err != nil {
+		in.Logger.Errorf("error while saving rewards state: %v", err)
+	}
+}
+
+// parseComeBack reads the time to wait before claiming a reward again from a
+// response like "come back in 20h 15m". The second return value is false if s
+// is not such a response.
+func parseComeBack(s string) (time.Duration, bool) {
+	match := exp.rewardWait.FindStringSubmatch(s)
+	if match == nil {
+		return 0, false
+	}
+	units := map[string]time.Duration{
+		"d": time.Hour * 24,
+		"h": time.Hour,
+		"m": time.Minute,
+		"s": time.Second,
+	}
+	var d time.Duration
+	for _, part := range exp.rewardWaitPart.FindAllStringSubmatch(match[1], -1) {
+		n, _ := strconv.Atoi(part[1])
+		d += time.Duration(n) * units[strings.ToLower(part[2][:1])]
+	}
+	if d == 0 {
+		return 0, false
+	}
+	return d, true
+}
@@ -1,8 +1,10 @@
 package instance
 
 import (
-	"math/rand"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dankgrinder/dankgrinder/discord"
 	"github.com/dankgrinder/dankgrinder/instance/scheduler"
@@ -12,26 +14,73 @@ import (
 
 const DMID = "270904126974590976"
 
+// resultTimeout is the maximum time between picking an option for a game
+// command and receiving its outcome for the outcome to still be attributed to
+// that option.
+const resultTimeout = time.Second * 30
+
 var exp = struct {
 	search,
 	fhEvent,
 	hl,
+	hlResult,
 	bal,
+	bank,
+	pmResult,
 	gift,
 	shop,
+	shopItem,
+	shopSell,
+	shopBuy,
+	usePrompt,
+	rewardWait,
+	rewardWaitPart,
+	rewardStreak,
+	invItem,
+	invID,
+	invPage,
+	invChange,
 	blackjack,
+	blackjackPrompt,
+	blackjackOpts,
+	blackjackResponse,
+	blackjackResult,
 	blackjackBal,
-	event *regexp.Regexp
+	event,
+	coins,
+	death,
+	bold *regexp.Regexp
 }{
-	search:       regexp.MustCompile(`Pick from the list below and type the name in chat\.\s\x60(.+)\x60,\s\x60(.+)\x60,\s\x60(.+)\x60`),
-	fhEvent:      regexp.MustCompile(`10\sseconds.*\s?([Tt]yping|[Tt]ype)\s\x60(.+)\x60`),
-	hl:           regexp.MustCompile(`Your hint is \*\*([0-9]+)\*\*`),
-	bal:          regexp.MustCompile(`\*\*Wallet\*\*: \x60?⏣?\s?([0-9,]+)\x60?`),
-	event:        regexp.MustCompile(`^(Attack the boss by typing|Type) \x60(.+)\x60`),
-	gift:         regexp.MustCompile(`[a-zA-Z\s]* \(([0-9,]+) owned\)`),
-	shop:         regexp.MustCompile(`pls shop ([a-zA-Z\s]+)`),
-	blackjack:    regexp.MustCompile(`\x60[♥♦♠♣] ([0-9]{1,2}|[JQKA])\x60`),
-	blackjackBal: regexp.MustCompile(`(You now have|You have) (\*\*)?(⏣\s)?(\*\*)?([0-9,]+)(\*\*)?(\sstill)?\.`),
+	search:            regexp.MustCompile(`Pick from the list below and type the name in chat\.\s\x60(.+)\x60,\s\x60(.+)\x60,\s\x60(.+)\x60`),
+	fhEvent:           regexp.MustCompile(`10\sseconds.*\s?([Tt]yping|[Tt]ype)\s\x60(.+)\x60`),
+	hl:                regexp.MustCompile(`Your hint is \*\*([0-9]+)\*\*`),
+	hlResult:          regexp.MustCompile(`(?i)\byou (won|lost)\b`),
+	bal:               regexp.MustCompile(`\*\*Wallet\*\*: \x60?⏣?\s?([0-9,]+)\x60?`),
+	bank:              regexp.MustCompile(`\*\*Bank\*\*: \x60?⏣?\s?([0-9,]+)\x60?(?:\s?/\s?\x60?⏣?\s?([0-9,]+)\x60?)?`),
+	pmResult:          regexp.MustCompile(`(?i)(your posted meme|upvotes|your meme)`),
+	event:             regexp.MustCompile(`^(Attack the boss by typing|Type) \x60(.+)\x60`),
+	gift:              regexp.MustCompile(`[a-zA-Z\s]* \(([0-9,]+) owned\)`),
+	shop:              regexp.MustCompile(`pls shop ([a-zA-Z\s]+)`),
+	shopItem:          regexp.MustCompile(`^\**([a-zA-Z'\s]+?)\**\s*\(([0-9,]+) owned\)`),
+	shopSell:          regexp.MustCompile(`(?i)\*\*sell\*\*\s?-\s?\**⏣?\s?([0-9,]+)`),
+	shopBuy:           regexp.MustCompile(`(?i)\*\*buy\*\*\s?-\s?\**⏣?\s?([0-9,]+)`),
+	usePrompt:         regexp.MustCompile(`(?i)(\(y/n\)|\x60y\x60|are you sure)`),
+	rewardWait:        regexp.MustCompile(`(?i)(?:come back|try again|ready|claim it again) in\s?\**((?:[0-9]+\s?(?:days?|hours?|hrs?|minutes?|mins?|seconds?|secs?|d|h|m|s)[\s,]*(?:and\s)?)+)`),
+	rewardWaitPart:    regexp.MustCompile(`(?i)([0-9]+)\s?(days?|hours?|hrs?|minutes?|mins?|seconds?|secs?|d|h|m|s)`),
+	rewardStreak:      regexp.MustCompile(`(?i)streak[^0-9\n]*([0-9,]+)`),
+	invItem:           regexp.MustCompile(`\*\*([^*\n]+)\*\*\s*─\s*([0-9,]+)`),
+	invID:             regexp.MustCompile(`ID\*?\s*\x60([a-zA-Z0-9]+)\x60`),
+	invPage:           regexp.MustCompile(`Page ([0-9]+) of ([0-9]+)`),
+	invChange:         regexp.MustCompile(`(?:\*\*)?([0-9,]+)?(?:\*\*)?\s*(?:an?\s)?(?:<a?:\w+:[0-9]+>\s*)?\*\*([^*]+)\*\*`),
+	blackjack:         regexp.MustCompile(`\x60[♥♦♠♣] ([0-9]{1,2}|[JQKA])\x60`),
+	blackjackPrompt:   regexp.MustCompile(`(?i)type \x60h\x60 to \*\*hit\*\*`),
+	blackjackOpts:     regexp.MustCompile(`(?i)type \x60([a-z])\x60 to \*\*([a-z ]+)\*\*`),
+	blackjackResponse: regexp.MustCompile(`^[a-z]$`),
+	blackjackResult:   regexp.MustCompile(`(?i)you (won|lost) (?:\*\*)?(?:⏣\s?)?([0-9,]+)`),
+	blackjackBal:      regexp.MustCompile(`(You now have|You have) (\*\*)?(⏣\s)?(\*\*)?([0-9,]+)(\*\*)?(\sstill)?\.`),
+	coins:             regexp.MustCompile(`⏣\s?([0-9,]+)`),
+	death:             regexp.MustCompile(`(?i)(\bdied\b|lost \*\*all of your coins\*\*)`),
+	bold:              regexp.MustCompile(`\*\*([^*]+)\*\*`),
 }
 
 var numFmt = message.NewPrinter(language.English)
@@ -58,14 +107,6 @@ func (in *Instance) fhEnd(msg discord.Message) {
 	}
 }
 
-func (in *Instance) pm(_ discord.Message) {
-	res := in.Compat.PostmemeOpts[rand.Intn(len(in.Compat.PostmemeOpts))]
-	in.sdlr.ResumeWithCommandOrPrioritySchedule(&scheduler.Command{
-		Value: res,
-		Log:   "responding to postmeme",
-	})
-}
-
 func (in *Instance) event(msg discord.Message) {
 	res := exp.event.FindStringSubmatch(msg.Content)[2]
 	in.sdlr.PrioritySchedule(&scheduler.Command{
@@ -74,6 +115,46 @@ func (in *Instance) event(msg discord.Message) {
 	})
 }
 
+// parseOutcome reads the coins gained, whether the user died and the items
+// found from the result message of a game command. Bold parts of the message
+// are considered items, unless they are a coin amount or one of exclude.
+func parseOutcome(content string, exclude ...string) (coins int, died bool, items []string) {
+	for _, match := range exp.coins.FindAllStringSubmatch(content, -1) {
+		n, err := strconv.Atoi(strings.Replace(match[1], ",", "", -1))
+		if err != nil {
+			continue
+		}
+		coins += n
+	}
+	if exp.death.MatchString(content) {
+		return 0, true, nil
+	}
+	for _, match := range exp.bold.FindAllStringSubmatch(content, -1) {
+		if item, ok := outcomeItem(match[1], exclude...); ok {
+			items = append(items, item)
+		}
+	}
+	return coins, false, items
+}
+
+// outcomeItem returns the cleaned name of the item in the bold part s of a
+// message, and false if s is empty, a coin amount, a number or one of exclude.
+func outcomeItem(s string, exclude ...string) (string, bool) {
+	item := strings.TrimSpace(clean(s))
+	if item == "" || strings.Contains(s, "⏣") {
+		return "", false
+	}
+	if _, err := strconv.Atoi(strings.Replace(item, ",", "", -1)); err == nil {
+		return "", false
+	}
+	for _, ex := range exclude {
+		if strings.EqualFold(item, ex) {
+			return "", false
+		}
+	}
+	return item, true
+}
+
 // clean removes all characters except for ASCII characters [32, 126] (basically
 // all keys you would find on a US keyboard).
 func clean(s string) string {
@@ -92,6 +173,7 @@ func (in *Instance) router() *discord.MessageRouter {
 
 	// Fishing and hunting.
 	rtr.NewRoute().
+		Name("fish/hunt event").
 		Channel(in.ChannelID).
 		Author(DMID).
 		ContentMatchesExp(exp.fhEvent).
@@ -102,21 +184,42 @@ func (in *Instance) router() *discord.MessageRouter {
 	// reference the original command. If there are events it will mention. This
 	// can therefore be used to differentiate between the two.
 	rtr.NewRoute().
+		Name("fish/hunt end").
 		Channel(in.ChannelID).
 		Author(DMID).
 		RespondsTo(in.Client.User.ID).
 		Handler(in.fhEnd)
 
+	// Beg result.
+	if in.Features.Commands.Beg {
+		rtr.NewRoute().
+			Name("beg result").
+			Channel(in.ChannelID).
+			Author(DMID).
+			RespondsTo(in.Client.User.ID).
+			Handler(in.begResult)
+	}
+
 	// Postmeme.
 	rtr.NewRoute().
+		Name("postmeme").
 		Channel(in.ChannelID).
 		Author(DMID).
 		ContentContains("What type of meme do you want to post").
 		Mentions(in.Client.User.ID).
 		Handler(in.pm)
 
+	// Postmeme result. The handler ignores the message if no meme type is
+	// awaiting its outcome.
+	rtr.NewRoute().
+		Name("postmeme result").
+		Channel(in.ChannelID).
+		Author(DMID).
+		Handler(in.pmResult)
+
 	// Global events.
 	rtr.NewRoute().
+		Name("global event").
 		Channel(in.ChannelID).
 		Author(DMID).
 		HasEmbeds(false).
@@ -125,64 +228,94 @@ func (in *Instance) router() *discord.MessageRouter {
 
 	// Search.
 	rtr.NewRoute().
+		Name("search").
 		Channel(in.ChannelID).
 		Author(DMID).
 		ContentMatchesExp(exp.search).
 		Mentions(in.Client.User.ID).
 		Handler(in.search)
 
+	// Search result. The handler ignores the message if no search location is
+	// awaiting its outcome.
+	rtr.NewRoute().
+		Name("search result").
+		Channel(in.ChannelID).
+		Author(DMID).
+		Handler(in.searchResult)
+
 	// Highlow.
 	rtr.NewRoute().
+		Name("highlow").
 		Channel(in.ChannelID).
 		Author(DMID).
 		HasEmbeds(true).
 		RespondsTo(in.Client.User.ID).
 		Handler(in.hl)
 
-	// Balance report.
-	if in.Features.BalanceCheck.Enable {
+	// Highlow result. The handler ignores the message if no highlow is
+	// awaiting its outcome.
+	rtr.NewRoute().
+		Name("highlow result").
+		Channel(in.ChannelID).
+		Author(DMID).
+		HasEmbeds(true).
+		RespondsTo(in.Client.User.ID).
+		Handler(in.hlResult)
+
+	// Inventory changes caused by buying, selling, gifting and hunting or
+	// fishing.
+	rtr.NewRoute().
+		Name("inventory change").
+		Channel(in.ChannelID).
+		Author(DMID).
+		HasEmbeds(false).
+		Handler(in.inventoryChange)
+
+	// Inventory report.
+	if in.Features.InventoryCheck.Enable {
 		rtr.NewRoute().
+			Name("inventory check").
 			Channel(in.ChannelID).
 			Author(DMID).
 			HasEmbeds(true).
-			Handler(in.balanceCheck)
+			Handler(in.inventoryCheck)
 	}
 
-	// Auto-buy laptop.
-	if in.Features.AutoBuy.Laptop {
-		rtr.NewRoute().
-			Channel(in.ChannelID).
-			Author(DMID).
-			ContentContains("oi you need to buy a laptop in the shop to post memes").
-			Mentions(in.Client.User.ID).
-			Handler(in.abLaptop)
-	}
+	// Shop item, which states the amount owned and the price of an item.
+	rtr.NewRoute().
+		Name("shop item").
+		Channel(in.ChannelID).
+		Author(DMID).
+		HasEmbeds(true).
+		Handler(in.shopItem)
 
-	// Auto-buy fishing pole.
-	if in.Features.AutoBuy.FishingPole {
+	// Balance report.
+	if in.Features.BalanceCheck.Enable {
 		rtr.NewRoute().
+			Name("balance check").
 			Channel(in.ChannelID).
 			Author(DMID).
-			ContentContains("You don't have a fishing pole").
-			Mentions(in.Client.User.ID).
-			Handler(in.abFishingPole)
+			HasEmbeds(true).
+			Handler(in.balanceCheck)
 	}
 
-	// Auto-buy hunting rifle.
-	if in.Features.AutoBuy.HuntingRifle {
-		rtr.NewRoute().
+	// Auto-buy.
+	for _, rule := range in.Features.AutoBuyRules() {
+		rt := rtr.NewRoute().
+			Name("auto-buy " + rule.Item).
 			Channel(in.ChannelID).
 			Author(DMID).
-			ContentContains("You don't have a hunting rifle").
-			Mentions(in.Client.User.ID).
-			Handler(in.abHuntingRifle)
+			ContentMatchesExp(regexp.MustCompile(rule.Pattern))
+		if rule.Mentions {
+			rt.Mentions(in.Client.User.ID)
+		}
+		rt.Handler(in.autoBuy(rule))
 	}
 
 	// Auto-gift
-	if in.Features.AutoGift.Enable &&
-		in.Master != nil &&
-		in != in.Master {
+	if in.Features.AutoGift.Enable {
 		rtr.NewRoute().
+			Name("auto-gift").
 			Channel(in.ChannelID).
 			Author(DMID).
 			HasEmbeds(true).
@@ -192,45 +325,73 @@ func (in *Instance) router() *discord.MessageRouter {
 	// Auto-tidepod
 	if in.Features.AutoTidepod.Enable {
 		rtr.NewRoute().
+			Name("auto-tidepod").
 			Channel(in.ChannelID).
 			Author(DMID).
 			ContentContains("There's a high chance you'll injure yourself from the tidepod").
 			Handler(in.tidepod)
 
 		rtr.NewRoute().
+			Name("auto-tidepod death").
 			Channel(in.ChannelID).
 			Author(DMID).
 			ContentContains("Eating a tidepod is just dumb and stupid.").
 			Handler(in.tidepodDeath)
 
 		rtr.NewRoute().
+			Name("auto-tidepod coins lost").
 			Channel(in.ChannelID).
 			Author(DMID).
 			ContentContains("You lost **all of your coins**.").
 			Handler(in.tidepodDeath)
+	}
 
+	// Rewards.
+	if len(in.enabledRewards()) > 0 {
 		rtr.NewRoute().
+			Name("reward").
 			Channel(in.ChannelID).
 			Author(DMID).
-			ContentContains("You don't own this item??").
-			Handler(in.abTidepod)
+			Handler(in.reward)
+	}
+
+	// Share and gift results.
+	rtr.NewRoute().
+		Name("transfer result").
+		Channel(in.ChannelID).
+		Author(DMID).
+		Handler(in.transferResult)
+
+	// Auto-use
+	if in.Features.AutoUse.Enable {
+		rtr.NewRoute().
+			Name("auto-use").
+			Channel(in.ChannelID).
+			Author(DMID).
+			Handler(in.autoUse)
 	}
 
 	// Auto-blackjack
 	if in.Features.AutoBlackjack.Enable {
 		rtr.NewRoute().
+			Name("auto-blackjack").
 			Channel(in.ChannelID).
 			Author(DMID).
 			HasEmbeds(true).
-			ContentContains("Type `h` to **hit**, type `s` to **stand**, or type `e` to **end** the game.").
+			ContentMatchesExp(exp.blackjackPrompt).
 			Handler(in.blackjack)
 
 		rtr.NewRoute().
+			Name("auto-blackjack end").
 			Channel(in.ChannelID).
 			Author(DMID).
 			HasEmbeds(true).
 			Handler(in.blackjackEnd)
 	}
 
+	rtr.Observe(in.logMessage)
+	if in.Journal != nil {
+		rtr.Observe(in.journalMessage)
+	}
 	return rtr
 }
@@ -0,0 +1,95 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"strings"
+
+	"github.com/dankgrinder/dankgrinder/config"
+)
+
+// routeTarget returns the instance that target refers to in the cluster with
+// the passed name, or in the instance's own cluster if name is empty. Other
+// clusters can only be targeted through the coordinator. The poorest and
+// richest instance are the ones with the lowest and highest wallet balance of
+// which the balance is known. nil is returned if there is no such instance or
+// if it is in itself.
+func (in *Instance) routeTarget(cluster, target string) *Instance {
+	master, members := in.Master, in.Cluster
+	if cluster != "" && cluster != in.ClusterName {
+		if in.Coordinator == nil {
+			return nil
+		}
+		var ok bool
+		if master, members, ok = in.Coordinator.Cluster(cluster); !ok {
+			return nil
+		}
+	}
+
+	var res *Instance
+	switch target {
+	case "", config.TargetMaster:
+		res = master
+	case config.TargetPoorest, config.TargetRichest:
+		for _, member := range members {
+			if member == in || member.IsClosed() || member.LastBalanceUpdate().IsZero() {
+				continue
+			}
+			if res == nil ||
+				(target == config.TargetPoorest && member.Balance() < res.Balance()) ||
+				(target == config.TargetRichest && member.Balance() > res.Balance()) {
+				res = member
+			}
+		}
+	default:
+		for _, member := range members {
+			if member.Name == target {
+				res = member
+			}
+		}
+	}
+	if res == in {
+		return nil
+	}
+	return res
+}
+
+// autoShare shares coins according to the first share route of which the
+// threshold is exceeded by balance and of which the target is available. It
+// returns true if coins are shared.
+func (in *Instance) autoShare(balance int) bool {
+	for _, route := range in.Features.ShareRoutes() {
+		if balance <= route.Above {
+			continue
+		}
+		target := in.routeTarget(route.Cluster, route.Target)
+		if target == nil {
+			continue
+		}
+		amount := balance - route.Keep
+		if route.Maximum > 0 && amount > route.Maximum {
+			amount = route.Maximum
+		}
+		in.sdlr.PrioritySchedule(in.newShare(amount, target, "sharing balance above threshold with "+target.Client.User.Username))
+		return true
+	}
+	return false
+}
+
+// giftRoute returns the first gift route for item of which the target is
+// available, and that target.
+func (in *Instance) giftRoute(item string) (config.GiftRoute, *Instance) {
+	for _, route := range in.Features.GiftRoutes() {
+		if itemKey(route.Item) != itemKey(strings.TrimSpace(item)) {
+			continue
+		}
+		if target := in.routeTarget(route.Cluster, route.Target); target != nil {
+			return route, target
+		}
+	}
+	return config.GiftRoute{}, nil
+}
@@ -8,6 +8,7 @@ package scheduler
 
 import (
 	"container/list"
+	"sync"
 )
 
 type queue struct {
@@ -18,8 +19,12 @@ type queue struct {
 	// currently for sending an abort in the scheduler when a priority command
 	// is enqueued.
 	onEnqueue func()
-	queued    *list.List
 	close     chan struct{}
+
+	// mu guards queued, which is only modified by the goroutine of the queue
+	// but may be read from any goroutine.
+	mu     sync.Mutex
+	queued *list.List
 }
 
 func newQueue() *queue {
@@ -32,12 +37,13 @@ func newQueue() *queue {
 	}
 	go func() {
 		for {
-			if q.queued.Len() == 0 {
+			front := q.front()
+			if front == nil {
 				select {
 				case <-q.close:
 					return
 				case cmd := <-q.enqueue:
-					q.queued.PushBack(cmd)
+					q.push(cmd)
 					go q.onEnqueue()
 				}
 				continue
@@ -46,16 +52,52 @@ func newQueue() *queue {
 			case <-q.close:
 				return
 			case cmd := <-q.enqueue:
-				q.queued.PushBack(cmd)
+				q.push(cmd)
 				go q.onEnqueue()
-			case q.dequeue <- q.queued.Front().Value.(*Command):
+			case q.dequeue <- front:
+				q.mu.Lock()
 				q.queued.Remove(q.queued.Front())
+				q.mu.Unlock()
 			}
 		}
 	}()
 	return q
 }
 
+func (q *queue) push(cmd *Command) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.queued.PushBack(cmd)
+}
+
+// front returns the first queued command, or nil if there is none.
+func (q *queue) front() *Command {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.queued.Len() == 0 {
+		return nil
+	}
+	return q.queued.Front().Value.(*Command)
+}
+
+// len returns the amount of queued commands.
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queued.Len()
+}
+
+// values returns the values of the queued commands in order.
+func (q *queue) values() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var values []string
+	for e := q.queued.Front(); e != nil; e = e.Next() {
+		values = append(values, e.Value.(*Command).Value)
+	}
+	return values
+}
+
 func (q *queue) Close() error {
 	q.close <- struct{}{}
 	close(q.close)
@@ -7,9 +7,13 @@
 package scheduler
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dankgrinder/dankgrinder/config"
@@ -19,13 +23,23 @@ import (
 
 type Scheduler struct {
 	Client             *discord.Client
-	Logger             *logrus.Logger
+	Logger             logrus.FieldLogger
 	ChannelID          string
 	Typing             *config.Typing
 	MessageDelay       *config.MessageDelay
 	AwaitResumeTimeout time.Duration
 	FatalHandler       func(err error)
 
+	// If not nil, SendHandler is called after every attempt to send a command
+	// with the delay and typing duration used and the error that occurred, if
+	// any. If the conditions of the command were not satisfied, err is
+	// ErrCondition.
+	SendHandler func(cmd *Command, delay, typing time.Duration, err error)
+
+	// If not nil, TimeoutHandler is called when a resume was not received
+	// within AwaitResumeTimeout after sending cmd.
+	TimeoutHandler func(cmd *Command)
+
 	queue              *queue
 	priorityQueue      *queue
 	close              chan struct{}
@@ -33,8 +47,32 @@ type Scheduler struct {
 	resume             chan *Command
 	awaitResume        bool
 	awaitResumeTrigger *Command
+
+	// sentMu guards lastSent, which is read by other goroutines through
+	// LastSent.
+	sentMu   sync.Mutex
+	lastSent *Command
+
+	// pauseMu guards unpause, which is not nil while the scheduler is paused
+	// and is closed when it is unpaused.
+	pauseMu sync.Mutex
+	unpause chan struct{}
 }
 
+// idPrefix and lastID make the ids of commands unique across all schedulers
+// of the process and across restarts. lastID is accessed atomically. idMu
+// guards the id and correlation id of every command, which are set by the
+// goroutine of a scheduler and read by others.
+var (
+	idPrefix = strconv.FormatInt(time.Now().UnixNano(), 36)
+	lastID   uint64
+	idMu     sync.RWMutex
+)
+
+// ErrCondition is passed to the send handler if a command was not sent because
+// its conditions were not satisfied.
+var ErrCondition = errors.New("conditions not satisfied")
+
 type Command struct {
 	Value string
 
@@ -69,7 +107,47 @@ type Command struct {
 	// reschedule Next if this is set to a different command.
 	CondFunc func() bool
 
-	execs uint
+	// If not nil, this function is called right before the command is sent and
+	// its result replaces Value. It is not called if CondFunc returns false.
+	ValueFunc func() string
+
+	// If not nil, this function is called after the command was sent. At that
+	// point, Execs includes this execution.
+	SendFunc func()
+
+	execs         uint
+	id            string
+	correlationID string
+}
+
+// ID returns the id of the last attempt to send the command. Every attempt has
+// a different id, made up of the user id of the client, the time at which the
+// process started and a sequence number.
+func (cmd *Command) ID() string {
+	idMu.RLock()
+	defer idMu.RUnlock()
+	return cmd.id
+}
+
+// CorrelationID returns the id shared by the last attempt to send the command
+// and the commands sent in response to it. It is the id of the first command
+// of the chain, which is the command itself unless it was passed to
+// ResumeWithCommand.
+func (cmd *Command) CorrelationID() string {
+	idMu.RLock()
+	defer idMu.RUnlock()
+	return cmd.correlationID
+}
+
+// Execs returns the amount of times the command was sent.
+func (cmd *Command) Execs() uint {
+	return cmd.execs
+}
+
+// SetExecs sets the amount of times the command was sent, for example to
+// restore it after a restart so Amount is not exceeded.
+func (cmd *Command) SetExecs(n uint) {
+	cmd.execs = n
 }
 
 func (s *Scheduler) Start() error {
@@ -99,28 +177,41 @@ func (s *Scheduler) Start() error {
 				case cmd := <-s.resume:
 					s.awaitResume = false
 					if cmd != nil {
-						s.send(cmd)
+						s.send(cmd, s.awaitResumeTrigger.CorrelationID())
 						continue
 					}
 				case <-time.After(s.AwaitResumeTimeout):
 					s.awaitResume = false
-					s.Logger.Errorf("await resume timed out for: %v", s.awaitResumeTrigger.Value)
+					s.Logger.WithFields(commandFields(s.awaitResumeTrigger)).Errorf("await resume timed out for: %v", s.awaitResumeTrigger.Value)
+					if s.TimeoutHandler != nil {
+						s.TimeoutHandler(s.awaitResumeTrigger)
+					}
+				case <-s.close:
+					return
+				}
+			}
+			// Responses to a command that is awaiting a resume are still sent
+			// while paused, so games and events are not left unfinished.
+			if unpause := s.unpaused(); unpause != nil {
+				select {
+				case <-unpause:
 				case <-s.close:
 					return
 				}
+				continue
 			}
-			if s.priorityQueue.queued.Len() > 0 {
+			if s.priorityQueue.len() > 0 {
 				cmd := <-s.priorityQueue.dequeue
-				s.send(cmd)
+				s.send(cmd, "")
 				continue
 			}
 			select {
 			case <-s.close:
 				return
 			case cmd := <-s.priorityQueue.dequeue:
-				s.send(cmd)
+				s.send(cmd, "")
 			case cmd := <-s.queue.dequeue:
-				s.send(cmd)
+				s.send(cmd, "")
 			}
 
 		}
@@ -138,6 +229,67 @@ func (s *Scheduler) AwaitResumeTrigger() *Command {
 	return s.awaitResumeTrigger
 }
 
+// LastSent returns the command that was sent last, or nil if no command was
+// sent yet.
+func (s *Scheduler) LastSent() *Command {
+	s.sentMu.Lock()
+	defer s.sentMu.Unlock()
+	return s.lastSent
+}
+
+// Pause stops the scheduler from sending commands until Unpause is called.
+// Commands can still be scheduled in the meantime. A command that is being sent
+// while Pause is called is still sent, as are commands passed to
+// ResumeWithCommand.
+func (s *Scheduler) Pause() {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	if s.unpause == nil {
+		s.unpause = make(chan struct{})
+	}
+}
+
+// Unpause makes a paused scheduler continue sending commands.
+func (s *Scheduler) Unpause() {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	if s.unpause != nil {
+		close(s.unpause)
+		s.unpause = nil
+	}
+}
+
+// Paused returns true if the scheduler is paused.
+func (s *Scheduler) Paused() bool {
+	return s.unpaused() != nil
+}
+
+// unpaused returns a channel which is closed once the scheduler is unpaused,
+// or nil if the scheduler is not paused.
+func (s *Scheduler) unpaused() chan struct{} {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	return s.unpause
+}
+
+// Queued returns the values of the commands in the priority queue followed by
+// those in the queue, in the order in which they will be sent.
+func (s *Scheduler) Queued() []string {
+	if s.queue == nil {
+		return nil
+	}
+	return append(s.priorityQueue.values(), s.queue.values()...)
+}
+
+// QueueLen returns the amount of commands in the queue and the priority queue
+// together.
+func (s *Scheduler) QueueLen() int {
+	if s.queue == nil {
+		return 0
+	}
+	return s.queue.len() + s.priorityQueue.len()
+}
+
 func (s *Scheduler) Schedule(cmd *Command) {
 	if s.isClosed {
 		return
@@ -234,7 +386,26 @@ func (s *Scheduler) reschedule(cmd *Command) {
 	})
 }
 
-func (s *Scheduler) send(cmd *Command) {
+// newID returns a new, unique command id.
+func (s *Scheduler) newID() string {
+	seq := strconv.FormatUint(atomic.AddUint64(&lastID, 1), 10)
+	if s.Client == nil {
+		return idPrefix + "-" + seq
+	}
+	return s.Client.User.ID + "-" + idPrefix + "-" + seq
+}
+
+// send sends cmd. If correlationID is an empty string, the command starts a new
+// chain of commands.
+func (s *Scheduler) send(cmd *Command, correlationID string) {
+	id := s.newID()
+	if correlationID == "" {
+		correlationID = id
+	}
+	idMu.Lock()
+	cmd.id, cmd.correlationID = id, correlationID
+	idMu.Unlock()
+	log := s.Logger.WithFields(commandFields(cmd))
 	if cmd.CondFunc != nil && !cmd.CondFunc() {
 		retryAfter := cmd.Interval
 		if retryAfter <= 0 {
@@ -243,21 +414,26 @@ func (s *Scheduler) send(cmd *Command) {
 		time.AfterFunc(retryAfter, func() {
 			s.Schedule(cmd)
 		})
-		s.Logger.Infof("stopped execution of command because its conditions were not satisfied: %v", cmd.Value)
+		log.Infof("stopped execution of command because its conditions were not satisfied: %v", cmd.Value)
+		s.handleSend(cmd, 0, 0, ErrCondition)
 		return
 	}
+	if cmd.ValueFunc != nil {
+		cmd.Value = cmd.ValueFunc()
+	}
 	d := delay(s.MessageDelay)
 	tt := typing(cmd.Value, s.Typing)
 	info := "sending command"
 	if cmd.Log != "" {
 		info = cmd.Log
 	}
-	s.Logger.WithFields(map[string]interface{}{
+	log.WithFields(map[string]interface{}{
 		"delay":  d.String(),
 		"typing": tt.String(),
 	}).Infof("%v: %v", info, cmd.Value)
 
 	err := s.Client.SendMessage(cmd.Value, s.ChannelID, tt)
+	s.handleSend(cmd, d, tt, err)
 	switch err {
 	case nil:
 	case discord.ErrForbidden, discord.ErrUnauthorized, discord.ErrNotFound:
@@ -272,25 +448,46 @@ func (s *Scheduler) send(cmd *Command) {
 		s.awaitResume = true
 		return
 	case discord.ErrIntervalServer:
-		s.Logger.Errorf("error while sending message: %v", err)
+		log.Errorf("error while sending message: %v", err)
 		s.PrioritySchedule(cmd)
 		return
 	case discord.ErrTooManyRequests:
-		s.Logger.Errorf("error while sending message: %v", err)
+		log.Errorf("error while sending message: %v", err)
 		s.PrioritySchedule(cmd)
-		s.Logger.Infof("sleeping for 20 seconds")
+		log.Infof("sleeping for 20 seconds")
 		time.Sleep(time.Second * 20)
 		return
 	default:
-		s.Logger.Errorf("error while sending message: %v", err)
+		log.Errorf("error while sending message: %v", err)
 		return
 	}
+	s.sentMu.Lock()
+	s.lastSent = cmd
+	s.sentMu.Unlock()
 	s.reschedule(cmd)
+	if cmd.SendFunc != nil {
+		cmd.SendFunc()
+	}
 	if cmd.AwaitResume {
 		s.awaitResumeTrigger, s.awaitResume = cmd, true
 	}
 }
 
+// commandFields returns the fields which identify the last attempt to send cmd
+// in logs.
+func commandFields(cmd *Command) logrus.Fields {
+	return logrus.Fields{
+		"command_id":     cmd.ID(),
+		"correlation_id": cmd.CorrelationID(),
+	}
+}
+
+func (s *Scheduler) handleSend(cmd *Command, d, tt time.Duration, err error) {
+	if s.SendHandler != nil {
+		s.SendHandler(cmd, d, tt, err)
+	}
+}
+
 // typing returns a duration for which to type based on the variables in the
 // config.
 func typing(cmd string, typing *config.Typing) time.Duration {
@@ -8,26 +8,97 @@ package instance
 
 import (
 	"math/rand"
+	"strings"
 
+	"github.com/dankgrinder/dankgrinder/analytics"
+	"github.com/dankgrinder/dankgrinder/config"
 	"github.com/dankgrinder/dankgrinder/discord"
 	"github.com/dankgrinder/dankgrinder/instance/scheduler"
 )
 
+const searchStatsName = "search"
+
 func (in *Instance) search(msg discord.Message) {
 	choices := exp.search.FindStringSubmatch(msg.Content)[1:]
-	for _, choice := range choices {
-		for _, allowed := range in.Compat.AllowedSearches {
-			if choice == allowed {
-				in.sdlr.ResumeWithCommandOrPrioritySchedule(&scheduler.Command{
-					Value: choice,
-					Log:   "responding to search",
-				})
-				return
-			}
-		}
+	if choice := in.searchChoice(choices); choice != "" {
+		in.pendingSearch.set(choice)
+		in.sdlr.ResumeWithCommandOrPrioritySchedule(&scheduler.Command{
+			Value: choice,
+			Log:   "responding to search",
+		})
+		return
 	}
 	in.sdlr.ResumeWithCommandOrPrioritySchedule(&scheduler.Command{
 		Value: in.Compat.SearchCancel[rand.Intn(len(in.Compat.SearchCancel))],
 		Log:   "no allowed search options provided, responding",
 	})
 }
+
+// searchChoice picks one of the offered search locations according to the
+// configured search strategy. An empty string is returned if the search should
+// be cancelled instead.
+func (in *Instance) searchChoice(choices []string) string {
+	strategy := in.Compat.SearchStrategy
+	switch strategy.Strategy {
+	case config.StrategyBestEV, config.StrategyEpsilonGreedy:
+		if strategy.Strategy == config.StrategyEpsilonGreedy && explore(strategy.Epsilon) {
+			return choices[rand.Intn(len(choices))]
+		}
+
+		// Locations without enough samples are only explored if they are
+		// allowed, to avoid dying over and over in unknown places.
+		choice, ev := in.searchStats.best(choices, in.balance, strategy.MinimumSamples, in.isAllowedSearch)
+		if ev < 0 {
+			return ""
+		}
+		return choice
+	}
+	for _, choice := range choices {
+		if in.isAllowedSearch(choice) {
+			return choice
+		}
+	}
+	return ""
+}
+
+func (in *Instance) isAllowedSearch(choice string) bool {
+	for _, allowed := range in.Compat.AllowedSearches {
+		if choice == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// searchResult records the outcome of the last search, so it can be used by
+// the search strategy for future choices. Results of other users are ignored.
+func (in *Instance) searchResult(msg discord.Message) {
+	if !in.isAddressed(msg) {
+		return
+	}
+	choice := in.pendingSearch.peek(resultTimeout)
+	if choice == "" || exp.search.MatchString(msg.Content) {
+		return
+	}
+	if !strings.Contains(strings.ToLower(msg.Content), strings.ToLower(choice)) {
+		return
+	}
+	in.pendingSearch.clear()
+
+	coins, died, items := parseOutcome(msg.Content, choice, in.Client.User.Username)
+	in.searchStats.record(choice, coins, died, items)
+	for _, item := range items {
+		in.inventory.add(item, 1)
+	}
+	in.recordIncome(analytics.SourceSearch, coins, in.itemsValue(items))
+	in.notifyRareItems(analytics.SourceSearch, items)
+	in.Logger.WithFields(map[string]interface{}{
+		"location": choice,
+		"coins":    coins,
+		"died":     died,
+		"items":    items,
+	}).Infof("recorded search outcome")
+	if err := in.save(searchStatsName, in.searchStats); err != nil {
+		in.Logger.Errorf("error while saving search statistics: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/analytics"
+	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+)
+
+// sellOrder is an amount of an item to sell.
+type sellOrder struct {
+	item   string
+	amount int
+	value  int // The expected revenue, 0 if the price is unknown.
+}
+
+// sellOrders returns the items to sell according to the inventory, leaving the
+// minimum stock of every item. The most valuable orders come first, so they are
+// sold even if the shift ends before all orders are.
+func (in *Instance) sellOrders() []sellOrder {
+	var orders []sellOrder
+	for _, item := range in.Features.AutoSell.Items {
+		it, _ := in.inventory.Item(item)
+		amount := it.Count - in.Features.AutoSell.MinimumStock[item]
+		if amount <= 0 {
+			continue
+		}
+		order := sellOrder{item: item, amount: amount}
+		if price, ok := in.prices.price(it); ok {
+			if price == 0 {
+				continue
+			}
+			order.value = price * amount
+		}
+		orders = append(orders, order)
+	}
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].value > orders[j].value
+	})
+	return orders
+}
+
+// autoSell schedules the sale of the items returned by sellOrders. It does
+// nothing if the auto-sell interval has not passed since the previous sale.
+func (in *Instance) autoSell() {
+	interval := time.Duration(in.Features.AutoSell.Interval) * time.Second
+	if !in.lastSell.IsZero() && time.Now().Sub(in.lastSell) < interval {
+		return
+	}
+	orders := in.sellOrders()
+	if len(orders) == 0 {
+		return
+	}
+	in.lastSell = time.Now()
+
+	var cmds []*scheduler.Command
+	for _, order := range orders {
+		log := "selling items"
+		if order.value > 0 {
+			log = "selling items for an expected " + numFmt.Sprintf("%d", order.value) + " coins"
+		}
+		cmds = append(cmds, &scheduler.Command{
+			Value:    sellCmdValue(strconv.Itoa(order.amount), order.item),
+			Log:      log,
+			Interval: time.Duration(in.Compat.Cooldown.Sell) * time.Second,
+		})
+	}
+	in.sdlr.Schedule(in.newCmdChain(cmds, 0))
+}
+
+// sellRevenue logs the revenue of a sale from the content of its message.
+func (in *Instance) sellRevenue(content string) {
+	match := exp.coins.FindStringSubmatch(content)
+	if match == nil {
+		return
+	}
+	revenue, err := strconv.Atoi(strings.Replace(match[1], ",", "", -1))
+	if err != nil {
+		in.Logger.Errorf("error while reading sale revenue: %v", err)
+		return
+	}
+	in.soldTotal += revenue
+	// The items were already counted as income when they were gained, so
+	// selling them only turns their value into coins.
+	in.recordIncome(analytics.SourceSell, revenue, -revenue)
+	in.Logger.Infof(
+		"sold items for %v coins, %v coins in total",
+		numFmt.Sprintf("%d", revenue),
+		numFmt.Sprintf("%d", in.soldTotal),
+	)
+}
@@ -0,0 +1,169 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+)
+
+const (
+	incomeStateName   = "income"
+	balanceStateName  = "balance"
+	commandsStateName = "commands"
+	shiftStateName    = "shift"
+)
+
+// incomeState is the starting point from which the average income is
+// calculated.
+type incomeState struct {
+	Balance       int       `json:"balance"`
+	Bank          int       `json:"bank"`
+	NetWorth      int       `json:"net_worth"`
+	NetWorthSince time.Time `json:"net_worth_since"`
+	StartedAt     time.Time `json:"started_at"`
+}
+
+// balanceState holds the last known balances.
+type balanceState struct {
+	Wallet       int       `json:"wallet"`
+	Bank         int       `json:"bank"`
+	BankCapacity int       `json:"bank_capacity"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// shiftState holds the position in the shift cycle.
+type shiftState struct {
+	Index int       `json:"index"`
+	State string    `json:"state"`
+	End   time.Time `json:"end"`
+}
+
+// commandExecs counts how many times each custom command was sent during the
+// current shift, so the amount of a custom command is not reset by a restart.
+type commandExecs struct {
+	mu     sync.Mutex
+	counts map[string]uint
+}
+
+// restoreState loads the state saved by a previous run.
+func (in *Instance) restoreState() {
+	var income incomeState
+	if err := in.load(incomeStateName, &income); err != nil {
+		in.Logger.Errorf("error while loading income state: %v", err)
+	}
+	if !income.StartedAt.IsZero() {
+		in.initialBalance = income.Balance
+		in.initialBank = income.Bank
+		in.initialNetWorth = income.NetWorth
+		in.netWorthSince = income.NetWorthSince
+		in.startingTime = income.StartedAt
+	}
+
+	var bal balanceState
+	if err := in.load(balanceStateName, &bal); err != nil {
+		in.Logger.Errorf("error while loading balance state: %v", err)
+	}
+	in.mu.Lock()
+	in.balance = bal.Wallet
+	in.bank = bal.Bank
+	in.bankCapacity = bal.BankCapacity
+	in.lastBalanceUpdate = bal.UpdatedAt
+	in.mu.Unlock()
+
+	in.execs.counts = map[string]uint{}
+	if err := in.load(commandsStateName, &in.execs.counts); err != nil {
+		in.Logger.Errorf("error while loading command state: %v", err)
+	}
+}
+
+func (in *Instance) saveIncome() {
+	err := in.save(incomeStateName, incomeState{
+		Balance:       in.initialBalance,
+		Bank:          in.initialBank,
+		NetWorth:      in.initialNetWorth,
+		NetWorthSince: in.netWorthSince,
+		StartedAt:     in.startingTime,
+	})
+	if err != nil {
+		in.Logger.Errorf("error while saving income state: %v", err)
+	}
+}
+
+func (in *Instance) saveBalance() {
+	err := in.save(balanceStateName, balanceState{
+		Wallet:       in.balance,
+		Bank:         in.bank,
+		BankCapacity: in.bankCapacity,
+		UpdatedAt:    in.lastBalanceUpdate,
+	})
+	if err != nil {
+		in.Logger.Errorf("error while saving balance state: %v", err)
+	}
+}
+
+// trackExecs restores the amount of times cmd was sent and keeps it saved as
+// the command is sent.
+func (in *Instance) trackExecs(cmd *scheduler.Command) {
+	in.execs.mu.Lock()
+	cmd.SetExecs(in.execs.counts[cmd.Value])
+	in.execs.mu.Unlock()
+	cmd.SendFunc = func() {
+		in.execs.mu.Lock()
+		defer in.execs.mu.Unlock()
+		in.execs.counts[cmd.Value] = cmd.Execs()
+		if err := in.save(commandsStateName, in.execs.counts); err != nil {
+			in.Logger.Errorf("error while saving command state: %v", err)
+		}
+	}
+}
+
+func (in *Instance) resetExecs() {
+	in.execs.mu.Lock()
+	defer in.execs.mu.Unlock()
+	if len(in.execs.counts) == 0 {
+		return
+	}
+	in.execs.counts = map[string]uint{}
+	if err := in.save(commandsStateName, in.execs.counts); err != nil {
+		in.Logger.Errorf("error while saving command state: %v", err)
+	}
+}
+
+// resumeShift returns the index of the shift to start with and whether that
+// shift was interrupted by a restart, in which case it is resumed. The
+// remaining duration of a resumed shift is returned, or 0 if the shift has no
+// end.
+func (in *Instance) resumeShift() (int, time.Duration, bool) {
+	var state shiftState
+	if err := in.load(shiftStateName, &state); err != nil {
+		in.Logger.Errorf("error while loading shift state: %v", err)
+		return 0, 0, false
+	}
+	if state.Index >= len(in.Shifts) || in.Shifts[state.Index].State != state.State {
+		return 0, 0, false
+	}
+	if state.End.IsZero() {
+		return state.Index, 0, true
+	}
+	if remaining := time.Until(state.End); remaining > 0 {
+		return state.Index, remaining, true
+	}
+	return (state.Index + 1) % len(in.Shifts), 0, false
+}
+
+func (in *Instance) saveShift(i int, dur time.Duration) {
+	state := shiftState{Index: i, State: in.Shifts[i].State}
+	if dur < maxShiftDur {
+		state.End = time.Now().Add(dur)
+	}
+	if err := in.save(shiftStateName, state); err != nil {
+		in.Logger.Errorf("error while saving shift state: %v", err)
+	}
+}
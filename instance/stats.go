@@ -0,0 +1,210 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// choiceStats keeps track of the observed outcomes of every option of a game
+// command, for example the locations offered by the search command.
+type choiceStats struct {
+	mu      sync.Mutex
+	Choices map[string]*choiceOutcome `json:"choices"`
+}
+
+type choiceOutcome struct {
+	Samples int            `json:"samples"`
+	Coins   int            `json:"coins"`
+	Deaths  int            `json:"deaths"`
+	Items   map[string]int `json:"items,omitempty"`
+}
+
+func newChoiceStats() *choiceStats {
+	return &choiceStats{Choices: map[string]*choiceOutcome{}}
+}
+
+// UnmarshalJSON makes sure the choices map is never nil after decoding.
+func (cs *choiceStats) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Choices map[string]*choiceOutcome `json:"choices"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.Choices = v.Choices
+	if cs.Choices == nil {
+		cs.Choices = map[string]*choiceOutcome{}
+	}
+	return nil
+}
+
+// record adds a single observed outcome for choice.
+func (cs *choiceStats) record(choice string, coins int, died bool, items []string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	o, ok := cs.Choices[choice]
+	if !ok {
+		o = &choiceOutcome{}
+		cs.Choices[choice] = o
+	}
+	o.Samples++
+	o.Coins += coins
+	if died {
+		o.Deaths++
+	}
+	for _, item := range items {
+		if o.Items == nil {
+			o.Items = map[string]int{}
+		}
+		o.Items[item]++
+	}
+}
+
+// MarshalJSON makes sure the statistics are not modified while they are being
+// encoded.
+func (cs *choiceStats) MarshalJSON() ([]byte, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return json.Marshal(struct {
+		Choices map[string]*choiceOutcome `json:"choices"`
+	}{cs.Choices})
+}
+
+// outcome returns a copy of the statistics of choice. The second return value
+// is false if nothing was recorded for it yet.
+func (cs *choiceStats) outcome(choice string) (choiceOutcome, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	o, ok := cs.Choices[choice]
+	if !ok {
+		return choiceOutcome{}, false
+	}
+	return *o, true
+}
+
+// summary returns the average amount of coins gained and the amount of samples
+// of every choice, formatted to be used as log fields.
+func (cs *choiceStats) summary() map[string]interface{} {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	res := map[string]interface{}{}
+	for choice, o := range cs.Choices {
+		res[choice] = fmt.Sprintf(
+			"%v coins over %v samples",
+			numFmt.Sprintf("%d", int(math.Round(o.expectedValue(0)))),
+			o.Samples,
+		)
+	}
+	return res
+}
+
+// ChoiceStatus is the observed outcome of one option of a game command.
+type ChoiceStatus struct {
+	Choice  string `json:"choice"`
+	Samples int    `json:"samples"`
+
+	// ExpectedValue is the average amount of coins gained per sample.
+	ExpectedValue int `json:"expected_value"`
+}
+
+// status returns the observed outcome of every choice, sorted by choice.
+func (cs *choiceStats) status() []ChoiceStatus {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	var res []ChoiceStatus
+	for choice, o := range cs.Choices {
+		res = append(res, ChoiceStatus{
+			Choice:        choice,
+			Samples:       o.Samples,
+			ExpectedValue: int(math.Round(o.expectedValue(0))),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Choice < res[j].Choice
+	})
+	return res
+}
+
+// expectedValue returns the average amount of coins gained per sample, minus
+// the wallet balance which is lost on average by dying.
+func (o choiceOutcome) expectedValue(balance int) float64 {
+	if o.Samples == 0 {
+		return 0
+	}
+	return (float64(o.Coins) - float64(o.Deaths)*float64(balance)) / float64(o.Samples)
+}
+
+// best returns the choice with the highest expected value out of choices.
+// Choices with fewer than minSamples samples are only considered if
+// canExplore returns true for them, in which case they are picked before any
+// other choice so their statistics can be gathered. An empty string is
+// returned if there are no candidates.
+func (cs *choiceStats) best(choices []string, balance, minSamples int, canExplore func(choice string) bool) (string, float64) {
+	var res string
+	var resEV float64
+	for _, choice := range choices {
+		o, _ := cs.outcome(choice)
+		if o.Samples < minSamples || o.Samples == 0 {
+			if canExplore(choice) {
+				return choice, 0
+			}
+			continue
+		}
+		ev := o.expectedValue(balance)
+		if res == "" || ev > resEV {
+			res, resEV = choice, ev
+		}
+	}
+	return res, resEV
+}
+
+// explore returns true with a chance of epsilon. It is used by epsilon-greedy
+// strategies to decide between picking a random option and the best one.
+func explore(epsilon float64) bool {
+	return rand.Float64() < epsilon
+}
+
+// pendingChoice holds the option that was last picked for a game command,
+// until the message with its outcome is received.
+type pendingChoice struct {
+	mu     sync.Mutex
+	choice string
+	at     time.Time
+}
+
+func (pc *pendingChoice) set(choice string) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.choice, pc.at = choice, time.Now()
+}
+
+// peek returns the pending choice without clearing it. An empty string is
+// returned if there is no choice pending or if it was made longer than timeout
+// ago.
+func (pc *pendingChoice) peek(timeout time.Duration) string {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.choice == "" || time.Since(pc.at) > timeout {
+		return ""
+	}
+	return pc.choice
+}
+
+func (pc *pendingChoice) clear() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.choice = ""
+}
@@ -9,6 +9,7 @@ package instance
 import (
 	"github.com/dankgrinder/dankgrinder/discord"
 	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+	"github.com/dankgrinder/dankgrinder/notify"
 )
 
 func (in *Instance) tidepod(_ discord.Message) {
@@ -27,6 +28,7 @@ func (in *Instance) tidepod(_ discord.Message) {
 }
 
 func (in *Instance) tidepodDeath(_ discord.Message) {
+	in.notify(notify.EventDeath, "died from a tidepod")
 	if in.Features.AutoTidepod.BuyLifesaverOnDeath {
 		in.sdlr.Schedule(&scheduler.Command{
 			Value: buyCmdValue("1", "lifesaver"),
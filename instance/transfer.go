@@ -0,0 +1,155 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package instance
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/discord"
+	"github.com/dankgrinder/dankgrinder/instance/scheduler"
+)
+
+const transferLogName = "transfers"
+
+const (
+	transferShare = "share"
+	transferGift  = "gift"
+)
+
+const (
+	transferPending   = "pending"
+	transferConfirmed = "confirmed"
+	transferFailed    = "failed"
+)
+
+// transfer is a share of coins or a gift of items to another instance. Every
+// transfer is appended to the transfer log once it is confirmed or has failed.
+type transfer struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Item   string    `json:"item,omitempty"`
+	Amount int       `json:"amount"`
+
+	// Received is the amount of coins received after tax, if it could be read
+	// from the confirmation.
+	Received int    `json:"received,omitempty"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason,omitempty"`
+	cmd      string
+}
+
+// pendingTransfers holds the transfers which were scheduled but of which the
+// result has not been received yet, keyed by command value.
+type pendingTransfers struct {
+	mu        sync.Mutex
+	transfers map[string]*transfer
+}
+
+func (p *pendingTransfers) add(t *transfer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.transfers == nil {
+		p.transfers = map[string]*transfer{}
+	}
+	p.transfers[t.cmd] = t
+}
+
+func (p *pendingTransfers) take(cmd string) *transfer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t := p.transfers[cmd]
+	delete(p.transfers, cmd)
+	return t
+}
+
+// newShare returns a command which shares amount coins with to. The result of
+// the command is awaited and logged.
+func (in *Instance) newShare(amount int, to *Instance, log string) *scheduler.Command {
+	cmd := shareCmdValue(strconv.Itoa(amount), to.Client.User.ID)
+	in.transfers.add(&transfer{
+		Kind:   transferShare,
+		From:   in.Client.User.ID,
+		To:     to.Client.User.ID,
+		Amount: amount,
+		Status: transferPending,
+		cmd:    cmd,
+	})
+	return &scheduler.Command{
+		Value:       cmd,
+		Log:         log,
+		AwaitResume: true,
+	}
+}
+
+// newGift returns a command which gifts amount of item to to. The result of the
+// command is awaited and logged.
+func (in *Instance) newGift(amount int, item string, to *Instance, log string) *scheduler.Command {
+	cmd := giftCmdValue(strconv.Itoa(amount), item, to.Client.User.ID)
+	in.transfers.add(&transfer{
+		Kind:   transferGift,
+		From:   in.Client.User.ID,
+		To:     to.Client.User.ID,
+		Item:   item,
+		Amount: amount,
+		Status: transferPending,
+		cmd:    cmd,
+	})
+	return &scheduler.Command{
+		Value:       cmd,
+		Log:         log,
+		AwaitResume: true,
+	}
+}
+
+// transferResult confirms a share or gift from its result, or marks it as failed
+// if the response to it is anything else. Responses to other users, including
+// their own shares and gifts, are ignored.
+func (in *Instance) transferResult(msg discord.Message) {
+	if !in.isAddressed(msg) {
+		return
+	}
+	trigger := in.sdlr.AwaitResumeTrigger()
+	if trigger == nil ||
+		(!strings.HasPrefix(trigger.Value, shareBaseCmdValue) && !strings.HasPrefix(trigger.Value, giftBaseCmdValue)) {
+		return
+	}
+	content := msg.Content
+	if len(msg.Embeds) > 0 {
+		content += "\n" + msg.Embeds[0].Description
+	}
+	confirmed := strings.Contains(strings.ToLower(content), "you gave")
+	in.sdlr.Resume()
+
+	t := in.transfers.take(trigger.Value)
+	if t == nil {
+		return
+	}
+	t.Time = time.Now()
+	if confirmed {
+		t.Status = transferConfirmed
+		if t.Kind == transferShare {
+			// The first amount of coins is the amount received, the others
+			// are the balances after the share.
+			if match := exp.coins.FindStringSubmatch(content); match != nil {
+				t.Received, _ = strconv.Atoi(strings.Replace(match[1], ",", "", -1))
+			}
+		}
+		in.Logger.Infof("%v to %v confirmed", t.Kind, t.To)
+	} else {
+		t.Status = transferFailed
+		t.Reason = clean(msg.Content)
+		in.Logger.Errorf("%v to %v failed: %v", t.Kind, t.To, t.Reason)
+	}
+	if err := in.appendRecord(transferLogName, t); err != nil {
+		in.Logger.Errorf("error while logging transfer: %v", err)
+	}
+}
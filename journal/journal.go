@@ -0,0 +1,108 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+// Package journal records the commands sent and the messages received by
+// instances as lines of JSON. The journal file is rotated with a rotate.Writer
+// once it reaches its maximum size.
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/rotate"
+)
+
+const (
+	KindCommand = "command"
+	KindMessage = "message"
+)
+
+// Entry is a single line of the journal. Which fields are set depends on Kind.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Instance string    `json:"instance"`
+	Username string    `json:"username,omitempty"`
+	Cluster  string    `json:"cluster,omitempty"`
+	Kind     string    `json:"kind"`
+
+	// Set for entries of KindCommand. Result is "sent" or the reason the
+	// command was not sent.
+	Command string `json:"command,omitempty"`
+	Delay   int64  `json:"delay_ms,omitempty"`
+	Typing  int64  `json:"typing_ms,omitempty"`
+	Result  string `json:"result,omitempty"`
+
+	// Set for entries of KindMessage. Routes holds the names of the routes
+	// that handled the message.
+	MessageID string   `json:"message_id,omitempty"`
+	Event     string   `json:"event,omitempty"`
+	Content   string   `json:"content,omitempty"`
+	Embed     string   `json:"embed,omitempty"`
+	Routes    []string `json:"routes,omitempty"`
+}
+
+// Journal is an append-only journal file. It is safe for concurrent use.
+type Journal struct {
+	// ErrorHandler is called with errors that occur while removing rotated
+	// journal files in the background. It may be nil.
+	ErrorHandler func(err error)
+
+	w *rotate.Writer
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// New returns a journal which appends to the file at path, which is created on
+// the first write. The file is rotated and rotated files are removed according
+// to opts, see rotate.Writer.
+func New(path string, opts rotate.Options) *Journal {
+	j := &Journal{w: rotate.New(path, opts)}
+	j.w.ErrorHandler = func(err error) {
+		if j.ErrorHandler != nil {
+			j.ErrorHandler(err)
+		}
+	}
+	return j
+}
+
+// Write appends e to the journal. If e.Time is zero, it is set to the current
+// time.
+func (j *Journal) Write(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error while encoding journal entry: %v", err)
+	}
+	b = append(b, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return fmt.Errorf("journal closed")
+	}
+	if _, err = j.w.Write(b); err != nil {
+		return fmt.Errorf("error while writing journal entry: %v", err)
+	}
+	return nil
+}
+
+// Close closes the journal file. Entries written after Close are discarded
+// with an error.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return nil
+	}
+	j.closed = true
+	return j.w.Close()
+}
@@ -9,26 +9,20 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/dankgrinder/dankgrinder/config"
+	"github.com/dankgrinder/dankgrinder/rotate"
 	"github.com/sirupsen/logrus"
 )
 
-// logFileWriter is an io.Writer that outputs to a file for logging.
-type logFileWriter struct {
-	username string
-	cluster  string
-	dir      string
-}
-
 // logFileHook is a logrus hook that writes all logs on a logger to a file as
 // well.
 type logFileHook struct {
-	dir string
+	w *rotate.Writer
 }
 
 // stdLoggerHook is a logrus hook that puts some of the logs on a logger on the
@@ -37,45 +31,17 @@ type stdLoggerHook struct {
 	cluster  string
 	username string
 	verbose  bool
-}
-
-func (lfw logFileWriter) Write(b []byte) (int, error) {
-	ld := path.Join(lfw.dir, "logs")
-	if _, err := os.Stat(ld); err != nil {
-		if os.IsNotExist(err) {
-			if err = os.Mkdir(ld, 0755); err != nil {
-				return 0, fmt.Errorf("error while creating logs dir: %v", err)
-			}
-		}
-	}
-
-	cld := path.Join(ld, lfw.cluster)
-	if _, err := os.Stat(cld); err != nil {
-		if os.IsNotExist(err) {
-			if err = os.Mkdir(cld, 0755); err != nil {
-				return 0, fmt.Errorf("error while creating cluster logs dir: %v", err)
-			}
-		}
-	}
 
-	uld := path.Join(cld, lfw.username)
-	if _, err := os.Stat(uld); err != nil {
-		if os.IsNotExist(err) {
-			if err = os.Mkdir(uld, 0755); err != nil {
-				return 0, fmt.Errorf("error while creating cluster intance log dir: %v", err)
-			}
-		}
-	}
-
-	date := time.Now().Format("02-01-2006")
+	// json is true if the standard logger logs as JSON, in which case the
+	// fields of fieldsHook are kept as they are.
+	json bool
+}
 
-	name := path.Join(uld, fmt.Sprintf("%v.log", date))
-	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0755)
-	if err != nil {
-		return 0, err
-	}
-	defer f.Close()
-	return f.Write(b)
+// fieldsHook is a logrus hook that adds fields to every log entry which does
+// not have them yet, so logs have the same fields regardless of where they were
+// written.
+type fieldsHook struct {
+	fields logrus.Fields
 }
 
 func (lfh logFileHook) Levels() []logrus.Level {
@@ -90,30 +56,12 @@ func (lfh logFileHook) Levels() []logrus.Level {
 }
 
 func (lfh logFileHook) Fire(e *logrus.Entry) error {
-	ld := path.Join(lfh.dir, "logs")
-	if _, err := os.Stat(ld); err != nil {
-		if os.IsNotExist(err) {
-			if err = os.Mkdir(ld, 0755); err != nil {
-				return fmt.Errorf("error while creating logs dir: %v", err)
-			}
-		}
-	}
-	date := time.Now().Format("02-01-2006")
-	name := fmt.Sprintf("logs/dankgrinder-%v.log", date)
-	f, err := os.OpenFile(path.Join(lfh.dir, name), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0755)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
 	b, err := (&logrus.JSONFormatter{}).Format(e)
 	if err != nil {
 		return err
 	}
-	_, err = f.Write(b)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err = lfh.w.Write(b)
+	return err
 }
 
 func (slh stdLoggerHook) Levels() []logrus.Level {
@@ -133,24 +81,48 @@ func (slh stdLoggerHook) Levels() []logrus.Level {
 }
 
 func (slh stdLoggerHook) Fire(e *logrus.Entry) error {
-	fields := e.Data
-	fields["instance"] = slh.username
-	fields["cluster"] = slh.cluster
+	fields := logrus.Fields{}
+	for k, v := range e.Data {
+		fields[k] = v
+	}
+	if !slh.json {
+		delete(fields, "instance_id")
+		delete(fields, "username")
+		fields["instance"] = slh.username
+		fields["cluster"] = slh.cluster
+	}
 	logrus.WithFields(fields).Log(e.Level, e.Message)
 	return nil
 }
 
+func (fh fieldsHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (fh fieldsHook) Fire(e *logrus.Entry) error {
+	for k, v := range fh.fields {
+		if _, ok := e.Data[k]; !ok {
+			e.Data[k] = v
+		}
+	}
+	return nil
+}
+
 type instanceLoggerOpts struct {
 	username             string
 	discriminator        string
 	cluster              string
 	dir                  string
+	rotation             rotate.Options
 	id                   string
 	debug                bool
+	json                 bool
 	verboseStdLoggerHook bool
 }
 
-func newInstanceLogger(opts instanceLoggerOpts) *logrus.Logger {
+// newInstanceLogger returns the logger of an instance and, if it logs to a
+// file, the writer of that file.
+func newInstanceLogger(opts instanceLoggerOpts) (*logrus.Logger, *rotate.Writer) {
 	rawUsername, cleanedUsername := opts.username, ""
 	allowedChars := regexp.MustCompile(`[a-zA-Z0-9-_]`)
 	rawUsername = strings.Replace(rawUsername, " ", "-", -1)
@@ -172,18 +144,44 @@ func newInstanceLogger(opts instanceLoggerOpts) *logrus.Logger {
 	}
 	logger = logrus.New()
 	logger.SetOutput(ioutil.Discard)
+	var w *rotate.Writer
 	if opts.dir != "" {
-		logger.SetOutput(logFileWriter{
-			username: fmt.Sprintf("%v#%v", cleanedUsername, opts.discriminator),
-			cluster:  opts.cluster,
-			dir:      opts.dir,
-		})
+		w = rotate.New(path.Join(
+			opts.dir,
+			opts.cluster,
+			fmt.Sprintf("%v#%v", cleanedUsername, opts.discriminator),
+			"instance.log",
+		), opts.rotation)
+		w.ErrorHandler = func(err error) {
+			logger.Errorf("%v", err)
+		}
+		logger.SetOutput(w)
 	}
 	logger.SetFormatter(&logrus.JSONFormatter{})
+
+	// The fields hook is added first, so other hooks receive its fields.
+	logger.AddHook(fieldsHook{fields: logrus.Fields{
+		"instance_id": opts.id,
+		"username":    fmt.Sprintf("%v#%v", opts.username, opts.discriminator),
+		"cluster":     opts.cluster,
+		"component":   config.LogComponentInstance,
+	}})
 	logger.AddHook(stdLoggerHook{
 		username: fmt.Sprintf("%v#%v", opts.username, opts.discriminator),
 		cluster:  opts.cluster,
 		verbose:  opts.verboseStdLoggerHook,
+		json:     opts.json,
 	})
-	return logger
+	return logger, w
+}
+
+// rotateOpts returns the options for rotating log files configured by r.
+func rotateOpts(r config.LogRotation) rotate.Options {
+	return rotate.Options{
+		MaxSize:  int64(r.MaximumSize) * 1024 * 1024,
+		Interval: time.Duration(r.Interval) * time.Hour,
+		Compress: r.Compress,
+		MaxAge:   time.Duration(r.MaximumAge) * time.Hour * 24,
+		MaxFiles: r.MaximumFiles,
+	}
 }
@@ -7,6 +7,8 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path"
@@ -20,6 +22,11 @@ import (
 
 	"github.com/dankgrinder/dankgrinder/config"
 	"github.com/dankgrinder/dankgrinder/discord"
+	"github.com/dankgrinder/dankgrinder/journal"
+	"github.com/dankgrinder/dankgrinder/notify"
+	"github.com/dankgrinder/dankgrinder/rotate"
+	"github.com/dankgrinder/dankgrinder/store"
+	"github.com/dankgrinder/dankgrinder/tui"
 	"github.com/sirupsen/logrus"
 )
 
@@ -33,10 +40,27 @@ func main() {
 	}
 	ex = filepath.ToSlash(ex)
 
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		if err = report(os.Stdout, path.Join(path.Dir(ex), "data"), os.Args[2:]); err != nil {
+			logrus.Fatalf("error while reporting income: %v", err)
+		}
+		return
+	}
+
+	var useTUI bool
+	var args []string
+	for _, arg := range os.Args[1:] {
+		if arg == "--tui" {
+			useTUI = true
+			continue
+		}
+		args = append(args, arg)
+	}
+
 	var cfg config.Config
-	if len(os.Args) > 1 {
-		logrus.Infof("loading config from %v", os.Args[1])
-		cfg, err = config.Load(os.Args[1])
+	if len(args) > 0 {
+		logrus.Infof("loading config from %v", args[0])
+		cfg, err = config.Load(args[0])
 	} else {
 		logrus.Infof("loading config from %v", path.Join(path.Dir(ex), "config.yml"))
 		cfg, err = config.Load(path.Join(path.Dir(ex), "config.yml"))
@@ -47,20 +71,78 @@ func main() {
 	if cfg.Features.Debug {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
-	logrus.AddHook(logFileHook{dir: path.Dir(ex)})
+	logDir := path.Join(path.Dir(ex), "logs")
+	if cfg.Logging.Directory != "" {
+		logDir = filepath.ToSlash(cfg.Logging.Directory)
+		if !filepath.IsAbs(cfg.Logging.Directory) {
+			logDir = path.Join(path.Dir(ex), logDir)
+		}
+	}
+	logWriter := rotate.New(path.Join(logDir, "dankgrinder.log"), rotateOpts(cfg.Logging.Rotation))
+	logWriter.ErrorHandler = func(err error) {
+		logrus.Errorf("%v", err)
+	}
+	logWriters := []*rotate.Writer{logWriter}
+	logrus.AddHook(logFileHook{w: logWriter})
 
 	// Checks for many possible invalid configurations. This means that during
 	// execution of the program, many of these checks don't need to be repeated.
 	if err = cfg.Validate(); err != nil {
 		logrus.Fatalf("invalid config: %v", err)
 	}
+	logLevels := map[string]logrus.Level{}
+	for component, level := range cfg.Logging.Levels {
+		logLevels[component], _ = logrus.ParseLevel(level)
+
+		// Logs of instances are put on the standard logger, so it has to be
+		// at least as verbose as any component.
+		if logLevels[component] > logrus.GetLevel() {
+			logrus.SetLevel(logLevels[component])
+		}
+	}
+	if cfg.Logging.Format == config.LogFormatJSON {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+		logrus.SetOutput(os.Stdout)
+		logrus.AddHook(fieldsHook{fields: logrus.Fields{"component": "main"}})
+	}
 	if cfg.Compat.AwaitResponseTimeout < 3 {
 		logrus.Warnf("await response timeout is less than 3, this might cause stability issues for responses")
 	}
 
 	rand.Seed(time.Now().UnixNano())
 
+	dataDir := path.Join(path.Dir(ex), "data")
+	if err = os.MkdirAll(dataDir, 0755); err != nil {
+		logrus.Fatalf("error while creating data dir: %v", err)
+	}
+	st, err := store.Open(path.Join(dataDir, "state.db"))
+	if err != nil {
+		logrus.Fatalf("error while opening state store: %v", err)
+	}
+
+	var jrnl *journal.Journal
+	if cfg.Journal.Enable {
+		jrnl = journal.New(path.Join(dataDir, "journal.jsonl"), rotate.Options{
+			MaxSize:  int64(cfg.Journal.MaximumSize) * 1024 * 1024,
+			MaxFiles: cfg.Journal.MaximumFiles,
+		})
+		jrnl.ErrorHandler = func(err error) {
+			logrus.Errorf("%v", err)
+		}
+	}
+
+	var ntf *notify.Notifier
+	if cfg.Notifications.Enable {
+		ntf = newNotifier(cfg.Notifications)
+	}
+
+	var coordinator *instance.Coordinator
+	if cfg.Coordinator.Enable {
+		coordinator = &instance.Coordinator{}
+	}
+
 	wg := &sync.WaitGroup{}
+	var all []*instance.Instance
 	for ck, cluster := range cfg.Clusters {
 		var ins []*instance.Instance
 		var master *instance.Instance
@@ -79,6 +161,9 @@ func main() {
 			logrus.Infof("successful authorization as %v", client.User.Username+"#"+client.User.Discriminator)
 
 			in := &instance.Instance{
+				Name:               inOpts.Name,
+				ClusterName:        ck,
+				Coordinator:        coordinator,
 				Client:             client,
 				ChannelID:          inOpts.ChannelID,
 				WG:                 wg,
@@ -86,6 +171,13 @@ func main() {
 				SuspicionAvoidance: inOpts.SuspicionAvoidance,
 				Compat:             cfg.Compat,
 				Shifts:             inOpts.Shifts,
+				Store:              st,
+				Journal:            jrnl,
+				Notifier:           ntf,
+				LogLevels:          logLevels,
+				RareItems:          cfg.Notifications.RareItems,
+				RareItemValue:      cfg.Notifications.RareItemValue,
+				DataDir:            dataDir,
 			}
 
 			loggerOpts := instanceLoggerOpts{
@@ -95,11 +187,16 @@ func main() {
 				id:                   in.Client.User.ID,
 				debug:                in.Features.Debug,
 				verboseStdLoggerHook: in.Features.VerboseLogToStdout,
+				json:                 cfg.Logging.Format == config.LogFormatJSON,
 			}
 			if in.Features.LogToFile {
-				loggerOpts.dir = path.Dir(ex)
+				loggerOpts.dir = logDir
+				loggerOpts.rotation = rotateOpts(cfg.Logging.Rotation)
+			}
+			var w *rotate.Writer
+			if in.Logger, w = newInstanceLogger(loggerOpts); w != nil {
+				logWriters = append(logWriters, w)
 			}
-			in.Logger = newInstanceLogger(loggerOpts)
 
 			if i == len(cluster.Instances) {
 				master = in
@@ -107,15 +204,81 @@ func main() {
 			ins = append(ins, in)
 		}
 
+		if coordinator != nil {
+			coordinator.Register(ck, master, ins)
+		}
 		for _, in := range ins {
 			in.Master = master
 			in.Cluster = ins
-			if err = in.Start(); err != nil {
-				logrus.Fatalf("error while starting instance: %v", err)
-			}
 		}
+		all = append(all, ins...)
+	}
+
+	// The terminal ui hooks the loggers of the instances, so it is created
+	// before they start logging.
+	var ui *tui.UI
+	if useTUI {
+		ui = tui.New(all, os.Stdin, os.Stdout)
+		logrus.AddHook(ui)
+	}
+
+	// Instances are only started once all clusters are set up, so they can be
+	// reached through the coordinator right away.
+	for _, in := range all {
+		if err = in.Start(); err != nil {
+			logrus.Fatalf("error while starting instance: %v", err)
+		}
+	}
+	if cfg.Metrics.Enable {
+		go serveMetrics(cfg.Metrics.Address, all)
+	}
+	if cfg.Control.Enable {
+		go serveControl(cfg.Control.Address, cfg.Control.Token, all)
+	}
+	if ui != nil {
+		// Fatal errors are only written to the terminal once the terminal ui
+		// has been closed, otherwise they would not be readable.
+		logrus.RegisterExitHandler(func() {
+			ui.Close()
+			if msg := ui.LastError(); msg != "" {
+				fmt.Fprintln(os.Stderr, msg)
+			}
+		})
+		go func() {
+			logrus.SetOutput(ioutil.Discard)
+			err := ui.Run(func() {
+				closeAll(st, jrnl, ntf, logWriters)
+				os.Exit(0)
+			})
+			if err != nil {
+				logrus.SetOutput(ansicolor.NewAnsiColorWriter(os.Stdout))
+				logrus.Errorf("error while starting terminal ui: %v", err)
+			}
+		}()
 	}
 
 	wg.Wait()
+	closeAll(st, jrnl, ntf, logWriters)
 	logrus.Fatalf("no running instances left")
 }
+
+// closeAll closes the state store and the journal, if enabled, waits for
+// pending notifications to be delivered and closes the log files.
+func closeAll(st store.Store, jrnl *journal.Journal, ntf *notify.Notifier, logWriters []*rotate.Writer) {
+	if err := st.Close(); err != nil {
+		logrus.Errorf("error while closing state store: %v", err)
+	}
+	if jrnl != nil {
+		if err := jrnl.Close(); err != nil {
+			logrus.Errorf("error while closing journal: %v", err)
+		}
+	}
+	if ntf != nil {
+		ntf.Wait()
+	}
+	for _, w := range logWriters {
+		if err := w.Close(); err != nil {
+			logrus.Errorf("error while closing log file: %v", err)
+		}
+	}
+}
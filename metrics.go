@@ -0,0 +1,74 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/dankgrinder/dankgrinder/config"
+	"github.com/dankgrinder/dankgrinder/instance"
+	"github.com/dankgrinder/dankgrinder/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// collectMetrics returns the metrics of all instances, labeled with their
+// cluster and username.
+func collectMetrics(ins []*instance.Instance) []*metrics.Family {
+	balance := &metrics.Family{Name: "dankgrinder_balance_coins", Help: "Last known wallet balance.", Type: metrics.TypeGauge}
+	bank := &metrics.Family{Name: "dankgrinder_bank_coins", Help: "Last known bank balance.", Type: metrics.TypeGauge}
+	netWorth := &metrics.Family{Name: "dankgrinder_net_worth_coins", Help: "Estimated net worth, including the sell value of the inventory.", Type: metrics.TypeGauge}
+	sent := &metrics.Family{Name: "dankgrinder_commands_sent_total", Help: "Commands sent, by command type.", Type: metrics.TypeCounter}
+	sendErrors := &metrics.Family{Name: "dankgrinder_send_errors_total", Help: "Commands that could not be sent, by class of error.", Type: metrics.TypeCounter}
+	rateLimits := &metrics.Family{Name: "dankgrinder_rate_limit_waits_total", Help: "Times the scheduler waited because it was rate limited.", Type: metrics.TypeCounter}
+	queue := &metrics.Family{Name: "dankgrinder_queue_depth", Help: "Commands waiting in the scheduler queues.", Type: metrics.TypeGauge}
+	timeouts := &metrics.Family{Name: "dankgrinder_await_resume_timeouts_total", Help: "Times a response to a command was not received in time.", Type: metrics.TypeCounter}
+	reconnects := &metrics.Family{Name: "dankgrinder_websocket_reconnects_total", Help: "Times the websocket connection was re-established.", Type: metrics.TypeCounter}
+	latency := &metrics.Family{Name: "dankgrinder_heartbeat_latency_seconds", Help: "Time until the last websocket heartbeat was acknowledged.", Type: metrics.TypeGauge}
+	shift := &metrics.Family{Name: "dankgrinder_shift_state", Help: "1 for the state of the current shift, 0 for the other state.", Type: metrics.TypeGauge}
+
+	for _, in := range ins {
+		m := in.Metrics()
+		l := []string{"cluster", in.ClusterName, "username", in.Client.User.Username + "#" + in.Client.User.Discriminator}
+		balance.Add(float64(m.Balance), l...)
+		bank.Add(float64(m.Bank), l...)
+		netWorth.Add(float64(m.NetWorth), l...)
+		for cmd, n := range m.CommandsSent {
+			sent.Add(float64(n), append(l, "command", cmd)...)
+		}
+		for class, n := range m.SendErrors {
+			sendErrors.Add(float64(n), append(l, "class", class)...)
+		}
+		rateLimits.Add(float64(m.RateLimitWaits), l...)
+		queue.Add(float64(m.QueueDepth), l...)
+		timeouts.Add(float64(m.AwaitResumeTimeouts), l...)
+		reconnects.Add(float64(m.Reconnects), l...)
+		latency.Add(m.HeartbeatLatency.Seconds(), l...)
+		for _, state := range []string{config.ShiftStateActive, config.ShiftStateDormant} {
+			var v float64
+			if m.ShiftState == state {
+				v = 1
+			}
+			shift.Add(v, append(l, "state", state)...)
+		}
+	}
+	return []*metrics.Family{
+		balance, bank, netWorth, sent, sendErrors, rateLimits, queue, timeouts, reconnects, latency, shift,
+	}
+}
+
+// serveMetrics serves the metrics of ins on /metrics at addr. It does not
+// return unless the server fails.
+func serveMetrics(addr string, ins []*instance.Instance) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(func() []*metrics.Family {
+		return collectMetrics(ins)
+	}))
+	logrus.Infof("serving metrics on http://%v/metrics", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logrus.Errorf("error while serving metrics: %v", err)
+	}
+}
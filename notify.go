@@ -0,0 +1,40 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package main
+
+import (
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/config"
+	"github.com/dankgrinder/dankgrinder/notify"
+	"github.com/sirupsen/logrus"
+)
+
+// newNotifier returns a notifier which delivers events to the sinks in opts.
+func newNotifier(opts config.Notifications) *notify.Notifier {
+	n := &notify.Notifier{
+		ErrorHandler: func(err error) {
+			logrus.Errorf("%v", err)
+		},
+	}
+	for _, s := range opts.Sinks {
+		var sink notify.Sink
+		switch s.Type {
+		case config.SinkTypeWebhook:
+			sink = notify.Webhook{URL: s.URL}
+		case config.SinkTypeHTTP:
+			sink = notify.HTTP{URL: s.URL}
+		case config.SinkTypeCommand:
+			sink = notify.Command{Command: s.Command}
+		}
+		n.Add(sink, notify.Filter{
+			Events:   s.Events,
+			Cooldown: time.Duration(s.Cooldown) * time.Second,
+		})
+	}
+	return n
+}
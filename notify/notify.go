@@ -0,0 +1,142 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+// Package notify sends notifications about important events of instances to
+// sinks such as Discord webhooks, HTTP endpoints and shell commands.
+package notify
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// EventFatal is sent when an instance stops because of a fatal error.
+	EventFatal = "fatal"
+
+	// EventDeath is sent when an instance dies from a tidepod.
+	EventDeath = "death"
+
+	// EventBlackjackBroke is sent when an instance no longer has enough coins
+	// to play blackjack.
+	EventBlackjackBroke = "blackjack_broke"
+
+	// EventRareItem is sent when an instance finds a rare item.
+	EventRareItem = "rare_item"
+)
+
+// Events are all kinds of events.
+var Events = []string{EventFatal, EventDeath, EventBlackjackBroke, EventRareItem}
+
+// Event is something that happened to an instance.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Instance string    `json:"instance"`
+	Username string    `json:"username"`
+	Cluster  string    `json:"cluster"`
+	Message  string    `json:"message"`
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("[%v] %v (%v): %v", e.Kind, e.Username, e.Cluster, e.Message)
+}
+
+// Sink delivers events.
+type Sink interface {
+	Send(e Event) error
+}
+
+// Filter decides which events are delivered to a sink.
+type Filter struct {
+	// Events are the kinds of events that are delivered. All kinds are
+	// delivered if it is empty.
+	Events []string
+
+	// Cooldown is the minimum time between two events of the same kind for
+	// the same instance. Events within the cooldown are dropped.
+	Cooldown time.Duration
+}
+
+type filteredSink struct {
+	sink   Sink
+	filter Filter
+	last   map[string]time.Time
+}
+
+// allows returns true if e passes the filter of the sink, and if so, starts
+// the cooldown for its kind and instance.
+func (s *filteredSink) allows(e Event) bool {
+	if len(s.filter.Events) > 0 {
+		var ok bool
+		for _, kind := range s.filter.Events {
+			if kind == e.Kind {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	key := e.Kind + "/" + e.Instance
+	if last, ok := s.last[key]; ok && e.Time.Sub(last) < s.filter.Cooldown {
+		return false
+	}
+	s.last[key] = e.Time
+	return true
+}
+
+// Notifier delivers events to sinks in the background. It is safe for
+// concurrent use.
+type Notifier struct {
+	// ErrorHandler is called with errors that occur while delivering events.
+	// It may be nil.
+	ErrorHandler func(err error)
+
+	mu    sync.Mutex
+	sinks []*filteredSink
+	wg    sync.WaitGroup
+}
+
+// Add makes the notifier deliver the events which pass filter to sink.
+func (n *Notifier) Add(sink Sink, filter Filter) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sinks = append(n.sinks, &filteredSink{
+		sink:   sink,
+		filter: filter,
+		last:   map[string]time.Time{},
+	})
+}
+
+// Notify delivers e to every sink whose filter it passes, without waiting for
+// the delivery to complete. If e.Time is zero, it is set to the current time.
+func (n *Notifier) Notify(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, s := range n.sinks {
+		if !s.allows(e) {
+			continue
+		}
+		n.wg.Add(1)
+		go func(sink Sink) {
+			defer n.wg.Done()
+			if err := sink.Send(e); err != nil && n.ErrorHandler != nil {
+				n.ErrorHandler(fmt.Errorf("error while sending %v notification: %v", e.Kind, err))
+			}
+		}(s.sink)
+	}
+}
+
+// Wait blocks until all events passed to Notify have been delivered.
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// timeout is the maximum time it may take to deliver an event.
+const timeout = time.Second * 30
+
+var client = &http.Client{Timeout: timeout}
+
+// Webhook posts events as messages to a Discord webhook.
+type Webhook struct {
+	URL string
+}
+
+func (w Webhook) Send(e Event) error {
+	content := e.String()
+	if len(content) > 2000 {
+		content = content[:2000]
+	}
+	return postJSON(w.URL, map[string]string{
+		"username": "Dank Grinder",
+		"content":  content,
+	})
+}
+
+// HTTP posts events as JSON to a URL.
+type HTTP struct {
+	URL string
+}
+
+func (h HTTP) Send(e Event) error {
+	return postJSON(h.URL, e)
+}
+
+func postJSON(url string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error while encoding request body: %v", err)
+	}
+	res, err := client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("error while sending request: %v", err)
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %v", res.StatusCode)
+	}
+	return nil
+}
+
+// Command runs a shell command for every event. The event is passed as JSON
+// on the standard input, and its fields as the environment variables
+// DANKGRINDER_EVENT, DANKGRINDER_INSTANCE, DANKGRINDER_USERNAME,
+// DANKGRINDER_CLUSTER and DANKGRINDER_MESSAGE.
+type Command struct {
+	Command string
+}
+
+func (c Command) Send(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error while encoding event: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", c.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", c.Command)
+	}
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Env = append(
+		os.Environ(),
+		"DANKGRINDER_EVENT="+e.Kind,
+		"DANKGRINDER_INSTANCE="+e.Instance,
+		"DANKGRINDER_USERNAME="+e.Username,
+		"DANKGRINDER_CLUSTER="+e.Cluster,
+		"DANKGRINDER_MESSAGE="+e.Message,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error while running command: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
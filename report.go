@@ -0,0 +1,146 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dankgrinder/dankgrinder/analytics"
+)
+
+// report writes the income saved in the data folder to w per instance and per
+// cluster, as tables or as CSV. args are the arguments after the report
+// subcommand.
+func report(w io.Writer, dataDir string, args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	asCSV := fs.Bool("csv", false, "write CSV instead of tables")
+	since := fs.Duration("since", 0, "only report income of this long ago up to now, for example 24h")
+	dir := fs.String("data", dataDir, "the data folder to read the income history from")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+
+	var from time.Time
+	if *since > 0 {
+		from = time.Now().Add(-*since)
+	}
+	records, err := analytics.ReadDir(*dir, from)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("no income history in %v", *dir)
+	}
+
+	instances, clusters := analytics.ByInstance(records), analytics.ByCluster(records)
+	if *asCSV {
+		return reportCSV(w, instances, clusters)
+	}
+	for _, s := range instances {
+		fmt.Fprintf(w, "instance %v (cluster %v), %v\n", s.Name, s.Cluster, span(s))
+		if err = reportTable(w, s); err != nil {
+			return err
+		}
+	}
+	for _, s := range clusters {
+		fmt.Fprintf(w, "cluster %v, %v\n", s.Name, span(s))
+		if err = reportTable(w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func span(s analytics.Summary) string {
+	return fmt.Sprintf(
+		"%v to %v",
+		s.Start.Format("2006-01-02 15:04"),
+		s.End.Format("2006-01-02 15:04"),
+	)
+}
+
+// reportRows returns a row for every source of s and a total row, with the
+// source, count, coins, items, net, hourly and daily rate in that order.
+func reportRows(s analytics.Summary) [][]string {
+	row := func(name string, t analytics.Total) []string {
+		return []string{
+			name,
+			strconv.Itoa(t.Count),
+			strconv.Itoa(t.Coins),
+			strconv.Itoa(t.Items),
+			strconv.Itoa(t.Net()),
+			strconv.Itoa(int(math.Round(s.Hourly(t.Net())))),
+			strconv.Itoa(int(math.Round(s.Daily(t.Net())))),
+		}
+	}
+	var rows [][]string
+	for _, source := range analytics.Sources {
+		if t, ok := s.Sources[source]; ok {
+			rows = append(rows, row(source, t))
+		}
+	}
+	return append(rows, row("total", s.Total()))
+}
+
+var reportHeader = []string{"source", "count", "coins", "items", "net", "net/h", "net/d"}
+
+func reportTable(w io.Writer, s analytics.Summary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, row := range append([][]string{reportHeader}, reportRows(s)...) {
+		for _, col := range row {
+			fmt.Fprintf(tw, "%v\t", col)
+		}
+		fmt.Fprintln(tw)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+func reportCSV(w io.Writer, instances, clusters []analytics.Summary) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"scope", "name", "cluster", "start", "end"}, reportHeader...)); err != nil {
+		return err
+	}
+	write := func(scope string, summaries []analytics.Summary) error {
+		for _, s := range summaries {
+			for _, row := range reportRows(s) {
+				err := cw.Write(append([]string{
+					scope,
+					s.Name,
+					s.Cluster,
+					s.Start.Format(time.RFC3339),
+					s.End.Format(time.RFC3339),
+				}, row...))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := write("instance", instances); err != nil {
+		return err
+	}
+	if err := write("cluster", clusters); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,271 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+// Package rotate provides a writer for log files which rotates them by size and
+// time, optionally compresses rotated files and removes old ones.
+package rotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeFormat is the format of the time in the names of rotated files, which
+// sort from oldest to newest. It does not contain colons, which are not allowed
+// in file names on Windows.
+const timeFormat = "2006-01-02T15-04-05.000"
+
+// Options configure when files are rotated and how long they are kept. The zero
+// value never rotates.
+type Options struct {
+	// MaxSize is the size in bytes above which the file is rotated. Set to 0
+	// to not rotate by size.
+	MaxSize int64
+
+	// Interval is the period after which the file is rotated, counted from
+	// midnight in local time. An interval of 24 hours rotates the file every
+	// day. Set to 0 to not rotate by time.
+	Interval time.Duration
+
+	// Compress makes rotated files compressed with gzip.
+	Compress bool
+
+	// MaxAge is the age above which rotated files are removed. Set to 0 to keep
+	// rotated files regardless of their age.
+	MaxAge time.Duration
+
+	// MaxFiles is the amount of rotated files to keep. Set to 0 to keep all
+	// rotated files.
+	MaxFiles int
+}
+
+// Writer is an io.WriteCloser which writes to a file and rotates it according
+// to its options. The file is named like path, rotated files have the time of
+// rotation added to their name, for example instance-2021-03-01T00-00-00.000.log.
+// Writer is safe for concurrent use.
+type Writer struct {
+	// ErrorHandler is called with errors that occur while compressing and
+	// removing rotated files in the background. It may be nil. It is called
+	// without holding any lock of the writer, so it may write to it.
+	ErrorHandler func(err error)
+
+	path string
+	opts Options
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	period time.Time
+
+	// bgMu serializes compressing and removing rotated files, which is done
+	// in the background. bg waits for it to complete.
+	bgMu sync.Mutex
+	bg   sync.WaitGroup
+}
+
+// New returns a writer to the file at path, which is opened on the first write.
+// The directory of path is created if it does not exist.
+func New(path string, opts Options) *Writer {
+	return &Writer{path: path, opts: opts}
+}
+
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return fmt.Errorf("error while creating log dir: %v", err)
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error while opening log file: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error while reading log file info: %v", err)
+	}
+	// An existing file is rotated on the next write if it was last written to
+	// in an earlier period.
+	w.f, w.size, w.period = f, info.Size(), w.periodOf(info.ModTime())
+	return nil
+}
+
+// periodOf returns the start of the rotation interval t is in.
+func (w *Writer) periodOf(t time.Time) time.Time {
+	if w.opts.Interval <= 0 {
+		return time.Time{}
+	}
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(w.opts.Interval).Add(-shift)
+}
+
+// Write writes b to the file, rotating it first if needed.
+func (w *Writer) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	now := time.Now()
+	bySize := w.opts.MaxSize > 0 && w.size+int64(len(b)) > w.opts.MaxSize
+	byTime := w.opts.Interval > 0 && !w.periodOf(now).Equal(w.period)
+	if w.size > 0 && (bySize || byTime) {
+		if err := w.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.f.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate renames the file, opens a new one and starts compressing and
+// removing rotated files in the background.
+func (w *Writer) rotate(now time.Time) error {
+	if err := w.f.Close(); err != nil {
+		return fmt.Errorf("error while closing log file: %v", err)
+	}
+	w.f = nil
+	name := w.rotatedName(now)
+	if err := os.Rename(w.path, name); err != nil {
+		return fmt.Errorf("error while rotating log file: %v", err)
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.bg.Add(1)
+	go func() {
+		defer w.bg.Done()
+		w.bgMu.Lock()
+		defer w.bgMu.Unlock()
+		if w.opts.Compress {
+			if err := compress(name); err != nil {
+				w.handleErr(err)
+			}
+		}
+		if err := w.removeOld(now); err != nil {
+			w.handleErr(err)
+		}
+	}()
+	return nil
+}
+
+// rotatedName returns a name for the file rotated at t which is not taken yet.
+func (w *Writer) rotatedName(t time.Time) string {
+	ext := filepath.Ext(w.path)
+	base := strings.TrimSuffix(w.path, ext) + "-" + t.Format(timeFormat)
+	name := base + ext
+	for i := 1; exists(name) || exists(name+".gz"); i++ {
+		name = fmt.Sprintf("%v-%v%v", base, i, ext)
+	}
+	return name
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// compress replaces the file at name by a gzip compressed copy named
+// name+".gz".
+func compress(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("error while opening rotated log file: %v", err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error while creating compressed log file: %v", err)
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return fmt.Errorf("error while compressing rotated log file: %v", err)
+	}
+	src.Close()
+	if err = os.Remove(name); err != nil {
+		return fmt.Errorf("error while removing rotated log file: %v", err)
+	}
+	return nil
+}
+
+// removeOld removes the rotated files which are older than MaxAge or exceed
+// MaxFiles, oldest first.
+func (w *Writer) removeOld(now time.Time) error {
+	if w.opts.MaxAge <= 0 && w.opts.MaxFiles <= 0 {
+		return nil
+	}
+	dir := filepath.Dir(w.path)
+	ext := filepath.Ext(w.path)
+	prefix := strings.TrimSuffix(filepath.Base(w.path), ext) + "-"
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error while reading log dir: %v", err)
+	}
+	var rotated []os.FileInfo
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if strings.HasSuffix(name, ext) || strings.HasSuffix(name, ext+".gz") {
+			rotated = append(rotated, info)
+		}
+	}
+	// Names contain the time of rotation, so the newest file sorts first.
+	sort.Slice(rotated, func(i, j int) bool {
+		return rotated[i].Name() > rotated[j].Name()
+	})
+	for i, info := range rotated {
+		tooMany := w.opts.MaxFiles > 0 && i >= w.opts.MaxFiles
+		tooOld := w.opts.MaxAge > 0 && now.Sub(info.ModTime()) > w.opts.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err = os.Remove(filepath.Join(dir, info.Name())); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error while removing old log file: %v", err)
+		}
+	}
+	return nil
+}
+
+func (w *Writer) handleErr(err error) {
+	if w.ErrorHandler != nil {
+		w.ErrorHandler(err)
+	}
+}
+
+// Close waits for rotated files to be compressed and removed and closes the
+// file. Writing after Close opens the file again.
+func (w *Writer) Close() error {
+	// The error handler may write to w, for example through a logger, so the
+	// background work is waited for before taking the lock.
+	w.bg.Wait()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
@@ -0,0 +1,56 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemory returns a store which keeps everything in memory, for example for
+// testing. Values are still encoded, so they behave like those of a persistent
+// store.
+func NewMemory() Store {
+	return &memoryStore{buckets: map[string]map[string][]byte{}}
+}
+
+func (s *memoryStore) Get(bucket, key string, v interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.buckets[bucket][key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("error while reading %v/%v: %v", bucket, key, err)
+	}
+	return true, nil
+}
+
+func (s *memoryStore) Put(bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error while encoding %v/%v: %v", bucket, key, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket] = map[string][]byte{}
+	}
+	s.buckets[bucket][key] = data
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
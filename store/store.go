@@ -0,0 +1,24 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+// Package store persists state that should survive a restart. Values are
+// encoded as JSON and kept under a key in a bucket, instances use their user id
+// as bucket.
+package store
+
+// Store is a persistent key-value store.
+type Store interface {
+	// Get decodes the value of key in bucket into v. The returned bool is
+	// false if there is no such value, in which case v is left untouched.
+	Get(bucket, key string, v interface{}) (bool, error)
+
+	// Put encodes v and stores it as the value of key in bucket, replacing any
+	// previous value.
+	Put(bucket, key string, v interface{}) error
+
+	// Close closes the store. It must not be used afterwards.
+	Close() error
+}
@@ -0,0 +1,98 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package store
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type record struct {
+	Name  string         `json:"name"`
+	Count int            `json:"count"`
+	Items map[string]int `json:"items"`
+}
+
+func testRoundTrip(t *testing.T, s Store) {
+	var got record
+	found, err := s.Get("bucket", "key", &got)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if found {
+		t.Errorf("value found in empty store")
+	}
+
+	want := record{Name: "name", Count: 3, Items: map[string]int{"fish": 2}}
+	if err = s.Put("bucket", "key", want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if found, err = s.Get("bucket", "key", &got); err != nil || !found {
+		t.Fatalf("value not found: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	want.Count = 4
+	if err = s.Put("bucket", "key", want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got = record{}
+	if _, err = s.Get("bucket", "key", &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Count != 4 {
+		t.Errorf("value not replaced: got count %v, want 4", got.Count)
+	}
+
+	for _, k := range [][2]string{{"bucket", "other"}, {"other", "key"}} {
+		if found, err = s.Get(k[0], k[1], &got); err != nil || found {
+			t.Errorf("%v/%v: found %v, error %v", k[0], k[1], found, err)
+		}
+	}
+
+	var n int
+	if err = s.Put("bucket", "number", 5); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = s.Get("bucket", "number", &got); err == nil {
+		t.Errorf("decoding a number into a struct: expected error")
+	}
+	if _, err = s.Get("bucket", "number", &n); err != nil || n != 5 {
+		t.Errorf("got %v, error %v, want 5", n, err)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	s := NewMemory()
+	defer s.Close()
+	testRoundTrip(t, s)
+}
+
+func TestBolt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testRoundTrip(t, s)
+	if err = s.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Values survive reopening the file.
+	if s, err = Open(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer s.Close()
+	var got record
+	if found, err := s.Get("bucket", "key", &got); err != nil || !found || got.Count != 4 {
+		t.Errorf("after reopening: got %+v, found %v, error %v", got, found, err)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dankgrinder/dankgrinder/instance"
+	"github.com/sirupsen/logrus"
+)
+
+// maxLines is the amount of log lines and errors kept per panel.
+const maxLines = 20
+
+// panel is the part of the screen that shows a single instance. It is a logrus
+// hook on the logger of the instance, so it receives the commands sent and the
+// responses logged by the scheduler and the handlers.
+type panel struct {
+	in *instance.Instance
+
+	mu     sync.Mutex
+	lines  []string
+	errors []string
+}
+
+func newPanel(in *instance.Instance) *panel {
+	p := &panel{in: in}
+	in.Logger.AddHook(p)
+	return p
+}
+
+func (p *panel) Levels() []logrus.Level {
+	return []logrus.Level{
+		logrus.InfoLevel,
+		logrus.WarnLevel,
+		logrus.ErrorLevel,
+		logrus.FatalLevel,
+		logrus.PanicLevel,
+	}
+}
+
+func (p *panel) Fire(e *logrus.Entry) error {
+	line := fmt.Sprintf("%v %v%v", e.Time.Format("15:04:05"), e.Message, fields(e.Data))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e.Level <= logrus.WarnLevel {
+		p.errors = appendLine(p.errors, line)
+		return nil
+	}
+	p.lines = appendLine(p.lines, line)
+	return nil
+}
+
+// recent returns the last n log lines and the last error, which is an empty
+// string if there is none.
+func (p *panel) recent(n int) (lines []string, lastErr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n > len(p.lines) {
+		n = len(p.lines)
+	}
+	lines = append(lines, p.lines[len(p.lines)-n:]...)
+	if len(p.errors) > 0 {
+		lastErr = p.errors[len(p.errors)-1]
+	}
+	return lines, lastErr
+}
+
+func appendLine(lines []string, line string) []string {
+	lines = append(lines, line)
+	if len(lines) > maxLines {
+		lines = lines[len(lines)-maxLines:]
+	}
+	return lines
+}
+
+// hiddenFields are the fields of log entries which the panel header already
+// shows or which only identify the entry for log aggregators.
+var hiddenFields = map[string]bool{
+	"instance":       true,
+	"instance_id":    true,
+	"username":       true,
+	"cluster":        true,
+	"component":      true,
+	"command_id":     true,
+	"correlation_id": true,
+}
+
+// fields formats the fields of a log entry, leaving out hiddenFields.
+func fields(data logrus.Fields) string {
+	var keys []string
+	for k := range data {
+		if hiddenFields[k] {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %v=%v", k, data[k])
+	}
+	return b.String()
+}
@@ -0,0 +1,370 @@
+// Copyright (C) 2021 The Dank Grinder authors.
+//
+// This source code has been released under the GNU Affero General Public
+// License v3.0. A copy of this license is available at
+// https://www.gnu.org/licenses/agpl-3.0.en.html
+
+// Package tui shows the state of running instances in the terminal, with a
+// panel per instance, instead of writing log lines to stdout.
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dankgrinder/dankgrinder/config"
+	"github.com/dankgrinder/dankgrinder/instance"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/term"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+const (
+	reset  = "\x1b[0m"
+	bold   = "\x1b[1m"
+	dim    = "\x1b[2m"
+	invert = "\x1b[7m"
+	red    = "\x1b[31m"
+	green  = "\x1b[32m"
+	yellow = "\x1b[33m"
+)
+
+var numFmt = message.NewPrinter(language.English)
+
+// UI is a terminal user interface for a set of instances.
+type UI struct {
+	panels []*panel
+	in     *os.File
+	out    io.Writer
+
+	mu       sync.Mutex
+	selected int
+	prompt   *string // Not nil while a command is being typed.
+	status   string  // Feedback on the last action.
+	restore  func()
+	redraw   chan struct{}
+	lastErr  string
+}
+
+// New creates a user interface for ins which reads keys from in and draws on
+// out. in must be a terminal. The loggers of the instances are hooked, so New
+// must be called before the instances log anything worth showing.
+func New(ins []*instance.Instance, in *os.File, out io.Writer) *UI {
+	ui := &UI{in: in, out: out, redraw: make(chan struct{}, 1)}
+	for _, i := range ins {
+		ui.panels = append(ui.panels, newPanel(i))
+	}
+	return ui
+}
+
+// Run puts the terminal in raw mode and draws the interface until the user
+// quits, after which the terminal is restored and onQuit is called. It returns
+// an error right away if there are no instances to show.
+func (ui *UI) Run(onQuit func()) error {
+	if len(ui.panels) == 0 {
+		return fmt.Errorf("no instances to show")
+	}
+	fd := int(ui.in.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("not a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("error while switching terminal to raw mode: %v", err)
+	}
+	var once sync.Once
+	ui.mu.Lock()
+	ui.restore = func() {
+		once.Do(func() {
+			fmt.Fprint(ui.out, "\x1b[?25h\x1b[?1049l")
+			term.Restore(fd, state)
+		})
+	}
+	ui.mu.Unlock()
+
+	// Switch to the alternate screen and hide the cursor.
+	fmt.Fprint(ui.out, "\x1b[?1049h\x1b[?25l")
+
+	quit := make(chan struct{})
+	go ui.readKeys(quit)
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		ui.draw()
+		select {
+		case <-quit:
+			ui.Close()
+			onQuit()
+			return nil
+		case <-ui.redraw:
+		case <-t.C:
+		}
+	}
+}
+
+// Close restores the terminal. It is safe to call more than once and from any
+// goroutine, for example before the program exits because of a fatal error.
+func (ui *UI) Close() {
+	ui.mu.Lock()
+	restore := ui.restore
+	ui.mu.Unlock()
+	if restore != nil {
+		restore()
+	}
+}
+
+// Levels and Fire make the UI a logrus hook, which shows warnings and errors of
+// the logger it is added to.
+func (ui *UI) Levels() []logrus.Level {
+	return []logrus.Level{
+		logrus.WarnLevel,
+		logrus.ErrorLevel,
+		logrus.FatalLevel,
+		logrus.PanicLevel,
+	}
+}
+
+func (ui *UI) Fire(e *logrus.Entry) error {
+	msg := e.Message
+	if name, ok := e.Data["instance"]; ok {
+		msg = fmt.Sprintf("%v: %v", name, msg)
+	}
+	ui.mu.Lock()
+	ui.status = red + msg + reset
+	ui.lastErr = msg
+	ui.mu.Unlock()
+	ui.requestRedraw()
+	return nil
+}
+
+// LastError returns the last warning or error received as a logrus hook.
+func (ui *UI) LastError() string {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	return ui.lastErr
+}
+
+func (ui *UI) requestRedraw() {
+	select {
+	case ui.redraw <- struct{}{}:
+	default:
+	}
+}
+
+// readKeys handles key presses until the user quits, after which quit is
+// closed.
+func (ui *UI) readKeys(quit chan struct{}) {
+	buf := make([]byte, 64)
+	for {
+		n, err := ui.in.Read(buf)
+		if err != nil {
+			close(quit)
+			return
+		}
+		if ui.handleKeys(buf[:n]) {
+			close(quit)
+			return
+		}
+		ui.requestRedraw()
+	}
+}
+
+// handleKeys handles the input of a single read. It returns true if the user
+// quits.
+func (ui *UI) handleKeys(b []byte) bool {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	if ui.prompt != nil {
+		ui.handlePrompt(b)
+		return false
+	}
+	switch string(b) {
+	case "q", "\x03":
+		return true
+	case "\x1b[A", "k":
+		if ui.selected > 0 {
+			ui.selected--
+		}
+	case "\x1b[B", "j", "\t":
+		if ui.selected < len(ui.panels)-1 {
+			ui.selected++
+		}
+	case "p":
+		in := ui.panels[ui.selected].in
+		if in.Status().Paused {
+			in.Resume()
+			ui.status = "resumed " + in.Client.User.Username
+		} else {
+			in.Pause()
+			ui.status = "paused " + in.Client.User.Username
+		}
+	case "r":
+		ui.prompt = new(string)
+	}
+	return false
+}
+
+// handlePrompt edits the command being typed. Enter runs it on the selected
+// instance and escape cancels it.
+func (ui *UI) handlePrompt(b []byte) {
+	switch {
+	case string(b) == "\x1b" || string(b) == "\x03":
+		ui.prompt = nil
+	case b[0] == '\r' || b[0] == '\n':
+		in := ui.panels[ui.selected].in
+		if err := in.Run(*ui.prompt); err != nil {
+			ui.status = fmt.Sprintf("could not run command on %v: %v", in.Client.User.Username, err)
+		} else {
+			ui.status = fmt.Sprintf("queued %q on %v", *ui.prompt, in.Client.User.Username)
+		}
+		ui.prompt = nil
+	case b[0] == 0x7f || b[0] == 0x08:
+		if _, size := utf8.DecodeLastRuneInString(*ui.prompt); size > 0 {
+			*ui.prompt = (*ui.prompt)[:len(*ui.prompt)-size]
+		}
+	case b[0] >= 0x20 && b[0] != 0x1b:
+		*ui.prompt += string(b)
+	}
+}
+
+func (ui *UI) draw() {
+	w, h, err := term.GetSize(int(ui.in.Fd()))
+	if err != nil {
+		w, h = 80, 24
+	}
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	if len(ui.panels) == 0 {
+		return
+	}
+
+	var lines []string
+	footer := dim + "↑/↓ select · p pause/resume · r run command · q quit" + reset
+	switch {
+	case ui.prompt != nil:
+		footer = fmt.Sprintf("run on %v: %v█", ui.panels[ui.selected].in.Client.User.Username, *ui.prompt)
+	case ui.status != "":
+		footer = ui.status + "  " + footer
+	}
+
+	// Every panel has a header and an error line besides its log lines. If
+	// not every panel fits, only those around the selected one are shown.
+	avail := h - 1
+	logLines := avail/len(ui.panels) - 2
+	if logLines > 5 {
+		logLines = 5
+	}
+	if logLines < 1 {
+		logLines = 1
+	}
+	perPanel := logLines + 2
+	visible := avail / perPanel
+	if visible < 1 {
+		visible = 1
+	}
+	first := 0
+	if ui.selected >= visible {
+		first = ui.selected - visible + 1
+	}
+	for i := first; i < len(ui.panels) && i < first+visible; i++ {
+		lines = append(lines, ui.panelLines(ui.panels[i], i == ui.selected, logLines)...)
+	}
+	for len(lines) < avail {
+		lines = append(lines, "")
+	}
+
+	// Lines are overwritten instead of clearing the screen first, which
+	// would flicker.
+	lines = append(lines[:avail], footer)
+	for i, line := range lines {
+		lines[i] = truncate(line, w) + reset + "\x1b[K"
+	}
+	fmt.Fprint(ui.out, "\x1b[H"+strings.Join(lines, "\r\n")+"\x1b[J")
+}
+
+func (ui *UI) panelLines(p *panel, selected bool, n int) []string {
+	s := p.in.Status()
+	name := s.Username
+	if s.Name != "" {
+		name += " (" + s.Name + ")"
+	}
+	state := dim + "starting" + reset
+	switch {
+	case s.Closed:
+		state = red + "closed" + reset
+	case s.State == config.ShiftStateActive:
+		state = green + "active" + reset
+	case s.State == config.ShiftStateDormant:
+		state = dim + "dormant" + reset
+	}
+	if !s.ShiftEnd.IsZero() && !s.Closed {
+		state += " " + timeLeft(time.Until(s.ShiftEnd))
+	}
+	if s.Paused {
+		state += " " + yellow + "paused" + reset
+	}
+	header := fmt.Sprintf(
+		"%v%v%v · %v · %v · wallet %v · bank %v · %v coins/h · %v queued",
+		bold, name, reset, s.Cluster, state,
+		numFmt.Sprintf("%d", s.Balance),
+		numFmt.Sprintf("%d", s.Bank),
+		numFmt.Sprintf("%d", s.HourlyIncome),
+		s.Queued,
+	)
+	if selected {
+		header = invert + "▶" + reset + " " + header
+	} else {
+		header = "  " + header
+	}
+
+	recent, lastErr := p.recent(n)
+	lines := []string{header}
+	for i := 0; i < n; i++ {
+		line := ""
+		if i < len(recent) {
+			line = "    " + recent[i]
+		}
+		lines = append(lines, line)
+	}
+	if lastErr != "" {
+		lastErr = "    " + red + lastErr + reset
+	}
+	return append(lines, lastErr)
+}
+
+func timeLeft(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return fmt.Sprintf("%dh%02dm left", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// truncate shortens s to w visible characters, not counting escape sequences.
+func truncate(s string, w int) string {
+	var b strings.Builder
+	var n int
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case r == '\x1b':
+			inEscape = true
+		case inEscape:
+			if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+				inEscape = false
+			}
+		default:
+			if n >= w {
+				continue
+			}
+			n++
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}